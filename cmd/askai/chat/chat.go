@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pastdev/askai/cmd/askai/config"
+	"github.com/pastdev/askai/pkg/lineedit"
+	"github.com/spf13/cobra"
+)
+
+func New(cfg *config.Config) *cobra.Command {
+	var conversation string
+	var model string
+	var system string
+	var stream bool
+
+	cmd := cobra.Command{
+		Use:   "chat",
+		Short: `An interactive multi-turn chat session`,
+		Long: `An interactive multi-turn chat session with line editing and history.
+
+Type a message to send it, or a slash command (see /help). Ctrl-C cancels the
+current response, and Ctrl-D or /exit ends the session.`,
+		Example: `  # start a new session
+  askai chat
+
+  # continue a named conversation, saving each exchange to it
+  askai chat --conversation myconv`,
+		//nolint: revive // required to match upstream signature
+		RunE: func(cmd *cobra.Command, args []string) error {
+			endpoint, err := cfg.EndpointConfig()
+			if err != nil {
+				return fmt.Errorf("new client: %w", err)
+			}
+
+			endpointName, err := cfg.EndpointName()
+			if err != nil {
+				return fmt.Errorf("new client: %w", err)
+			}
+
+			s := session{
+				cfg:          cfg,
+				editor:       lineedit.New(os.Stdin, os.Stdout),
+				endpointName: endpointName,
+				model:        model,
+				out:          os.Stdout,
+				stream:       stream,
+			}
+			err = s.setEndpoint(endpoint)
+			if err != nil {
+				return err
+			}
+
+			err = s.reset()
+			if err != nil {
+				return err
+			}
+
+			if conversation != "" {
+				err := s.load(conversation)
+				if err != nil {
+					return err
+				}
+			}
+
+			if system != "" {
+				s.setSystem(system)
+			}
+
+			return s.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&conversation,
+		"conversation",
+		"",
+		"A named conversation to start or continue, each exchange is saved to it")
+	cmd.Flags().StringVar(
+		&model,
+		"model",
+		"",
+		"AI model to use")
+	cmd.Flags().BoolVar(
+		&stream,
+		"stream",
+		true,
+		"Stream the responses")
+	cmd.Flags().StringVar(
+		&system,
+		"system",
+		"",
+		"A system message for the session")
+
+	return &cmd
+}
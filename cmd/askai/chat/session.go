@@ -0,0 +1,410 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pastdev/askai/cmd/askai/config"
+	"github.com/pastdev/askai/pkg/attachment"
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	pkgcfg "github.com/pastdev/askai/pkg/config"
+	"github.com/pastdev/askai/pkg/lineedit"
+	"github.com/pastdev/askai/pkg/tokenizer"
+	"github.com/sashabaranov/go-openai"
+)
+
+// errExit is returned by a command to end the session.
+var errExit = errors.New("exit")
+
+type command struct {
+	args string
+	help string
+	name string
+	run  func(s *session, args string) error
+}
+
+// session is the state of an interactive chat. The conversation is kept in
+// memory and, once it has a name, saved after every exchange so it can be
+// continued with complete --conversation.
+type session struct {
+	cfg          *config.Config
+	client       *openai.Client
+	conv         *chatcompletion.MemoryConversation
+	defaults     openai.ChatCompletionRequest
+	editor       *lineedit.Editor
+	endpoint     *pkgcfg.EndpointConfig
+	endpointName string
+	// model overrides the model of the conversation when set
+	model string
+	name  string
+	out   io.Writer
+	// pending are attachments for the next message
+	pending []openai.ChatMessagePart
+	stream  bool
+	// unsent is the last message if it failed or was cancelled so it can be
+	// retried
+	unsent *openai.ChatCompletionMessage
+}
+
+func commands() []command {
+	return []command{
+		{name: "attach", args: "<path>...", help: "attach files, directories, or globs to the next message", run: (*session).cmdAttach},
+		{name: "clear", help: "clear the conversation, keeping the system message", run: (*session).cmdClear},
+		{name: "endpoint", args: "[name]", help: "show or switch the endpoint", run: (*session).cmdEndpoint},
+		{name: "exit", help: "end the session", run: (*session).cmdExit},
+		{name: "help", help: "show this help", run: (*session).cmdHelp},
+		{name: "load", args: "<conversation>", help: "load a named conversation, later exchanges are saved to it", run: (*session).cmdLoad},
+		{name: "model", args: "[name]", help: "show or switch the model", run: (*session).cmdModel},
+		{name: "quit", help: "end the session", run: (*session).cmdExit},
+		{name: "retry", help: "regenerate the last response", run: (*session).cmdRetry},
+		{name: "save", args: "<conversation>", help: "save as a named conversation, later exchanges are saved to it", run: (*session).cmdSave},
+		{name: "system", args: "[message]", help: "show or replace the system message", run: (*session).cmdSystem},
+		{name: "tokens", help: "count the tokens in the conversation", run: (*session).cmdTokens},
+	}
+}
+
+// Run reads and handles lines until the input ends or the session is exited.
+func (s *session) Run() error {
+	for {
+		line, err := s.editor.ReadLine(s.prompt())
+		if errors.Is(err, lineedit.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("chat: %w", err)
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "/"):
+			err = s.runCommand(line[1:])
+			if errors.Is(err, errExit) {
+				return nil
+			}
+		default:
+			msg := openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: line,
+			}
+			attachment.AppendParts(&msg, s.pending)
+			s.pending = nil
+			err = s.send(msg)
+		}
+
+		if err != nil {
+			s.printf("error: %s\n", err)
+		}
+	}
+}
+
+func (s *session) cmdAttach(args string) error {
+	paths := strings.Fields(args)
+	if len(paths) == 0 {
+		return errors.New("usage: /attach <path>...")
+	}
+
+	files, err := attachment.Load(paths)
+	if err != nil {
+		return fmt.Errorf("attach: %w", err)
+	}
+
+	s.pending = append(s.pending, attachment.Parts(files, "")...)
+	for _, file := range files {
+		s.printf("attached %s\n", file.Name)
+	}
+	return nil
+}
+
+func (s *session) cmdClear(string) error {
+	system := s.systemMessages()
+	err := s.reset()
+	if err != nil {
+		return err
+	}
+	s.conv.Request.Messages = system
+	s.pending = nil
+	s.unsent = nil
+	s.printf("cleared\n")
+	return nil
+}
+
+func (s *session) cmdEndpoint(args string) error {
+	if args == "" {
+		s.printf("%s\n", s.endpointName)
+		return nil
+	}
+
+	cfg, err := s.cfg.Config()
+	if err != nil {
+		return fmt.Errorf("endpoint: %w", err)
+	}
+
+	endpoint, err := cfg.EndpointConfig(args)
+	if err != nil {
+		return fmt.Errorf("endpoint: %w", err)
+	}
+
+	err = s.setEndpoint(endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint: %w", err)
+	}
+	s.endpointName = args
+	s.conv.Request.Model = s.defaults.Model
+	s.printf("endpoint %s (model %s)\n", args, s.currentModel())
+	return nil
+}
+
+func (s *session) cmdExit(string) error {
+	return errExit
+}
+
+func (s *session) cmdHelp(string) error {
+	for _, cmd := range commands() {
+		usage := "/" + cmd.name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		s.printf("  %-26s %s\n", usage, cmd.help)
+	}
+	return nil
+}
+
+func (s *session) cmdLoad(args string) error {
+	if args == "" {
+		return errors.New("usage: /load <conversation>")
+	}
+
+	err := s.load(args)
+	if err != nil {
+		return err
+	}
+	s.printf("loaded %s (%d messages)\n", args, len(s.conv.Request.Messages))
+	return nil
+}
+
+func (s *session) cmdModel(args string) error {
+	if args != "" {
+		s.model = args
+	}
+	s.printf("%s\n", s.currentModel())
+	return nil
+}
+
+func (s *session) cmdRetry(string) error {
+	if s.unsent != nil {
+		return s.send(*s.unsent)
+	}
+
+	messages := s.conv.Request.Messages
+	n := len(messages)
+	if n < 2 ||
+		messages[n-1].Role != openai.ChatMessageRoleAssistant ||
+		messages[n-2].Role != openai.ChatMessageRoleUser {
+		return errors.New("nothing to retry")
+	}
+
+	msg := messages[n-2]
+	s.conv.Request.Messages = messages[:n-2]
+	return s.send(msg)
+}
+
+func (s *session) cmdSave(args string) error {
+	if args == "" {
+		return errors.New("usage: /save <conversation>")
+	}
+
+	s.name = args
+	err := s.save()
+	if err != nil {
+		return err
+	}
+	s.printf("saved %s\n", args)
+	return nil
+}
+
+func (s *session) cmdSystem(args string) error {
+	if args == "" {
+		for _, msg := range s.systemMessages() {
+			s.printf("%s\n", msg.Content)
+		}
+		return nil
+	}
+
+	s.setSystem(args)
+	return s.save()
+}
+
+func (s *session) cmdTokens(string) error {
+	model := s.currentModel()
+	tkzr, err := tokenizer.NewTokenizer(model)
+	approximate := ""
+	if err != nil {
+		tkzr = tokenizer.ApproximateTokenizer{}
+		approximate = "~"
+	}
+
+	count := func(msg openai.ChatCompletionMessage) int {
+		tokens := len(tkzr.Encode(msg.Content, nil, nil))
+		for _, part := range msg.MultiContent {
+			tokens += len(tkzr.Encode(part.Text, nil, nil))
+		}
+		return tokens
+	}
+
+	total := 0
+	for _, msg := range s.conv.Request.Messages {
+		total += count(msg)
+	}
+	pending := count(openai.ChatCompletionMessage{MultiContent: s.pending})
+
+	s.printf(
+		"%s%d tokens in %d messages (model %s)\n",
+		approximate,
+		total,
+		len(s.conv.Request.Messages),
+		model)
+	if pending > 0 {
+		s.printf("%s%d tokens in pending attachments\n", approximate, pending)
+	}
+	return nil
+}
+
+func (s *session) currentModel() string {
+	if s.model != "" {
+		return s.model
+	}
+	return s.conv.Request.Model
+}
+
+func (s *session) load(name string) error {
+	conv, err := chatcompletion.LoadPersistentConversation(name, s.defaults)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", name, err)
+	}
+
+	s.conv = &chatcompletion.MemoryConversation{Request: conv.Request()}
+	s.name = name
+	s.unsent = nil
+	return nil
+}
+
+func (s *session) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(s.out, format, a...)
+}
+
+func (s *session) prompt() string {
+	if s.name != "" {
+		return s.name + "> "
+	}
+	return "> "
+}
+
+func (s *session) reset() error {
+	conv, err := chatcompletion.NewMemoryConversation(s.defaults)
+	if err != nil {
+		return fmt.Errorf("new conversation: %w", err)
+	}
+	s.conv = conv
+	return nil
+}
+
+func (s *session) runCommand(line string) error {
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd.run(s, args)
+		}
+	}
+	return fmt.Errorf("unknown command /%s, see /help", name)
+}
+
+func (s *session) save() error {
+	if s.name == "" {
+		return nil
+	}
+
+	err := chatcompletion.NewPersistentConversation(s.name, s.conv.Request).Save()
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	return nil
+}
+
+// send sends msg and writes the response as it arrives. Ctrl-C, or the
+// --timeout expiring, cancels the response leaving the conversation as it was
+// before msg was sent.
+func (s *session) send(msg openai.ChatCompletionMessage) error {
+	snapshot := s.conv.Request
+	snapshot.Messages = slices.Clone(snapshot.Messages)
+
+	ctx, stop := s.cfg.Context()
+	defer stop()
+
+	err := chatcompletion.SendReply(
+		ctx,
+		s.client,
+		s.conv,
+		openai.ChatCompletionRequest{
+			Messages: []openai.ChatCompletionMessage{msg},
+			Model:    s.model,
+			Stream:   s.stream,
+		},
+		&chatcompletion.ContentResponseWriter{W: s.out})
+	s.printf("\n\n")
+	if err != nil {
+		s.conv.Request = snapshot
+		s.unsent = &msg
+		if ctx.Err() != nil {
+			s.printf("cancelled (use /retry to try again)\n")
+			return nil
+		}
+		return fmt.Errorf("send: %w", err)
+	}
+	s.unsent = nil
+
+	return s.save()
+}
+
+// setEndpoint sends requests to endpoint using its chat completion defaults
+// with those of the preset, if any, applied.
+func (s *session) setEndpoint(endpoint *pkgcfg.EndpointConfig) error {
+	defaults, err := s.cfg.ChatCompletionDefaults(endpoint)
+	if err != nil {
+		return err
+	}
+
+	s.endpoint = endpoint
+	s.client = endpoint.NewClient()
+	s.defaults = defaults
+	return nil
+}
+
+// setSystem replaces any system messages at the start of the conversation
+// with content.
+func (s *session) setSystem(content string) {
+	messages := s.conv.Request.Messages
+	rest := messages[len(s.systemMessages()):]
+	s.conv.Request.Messages = append(
+		[]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: content}},
+		rest...)
+}
+
+// systemMessages returns the system messages at the start of the
+// conversation.
+func (s *session) systemMessages() []openai.ChatCompletionMessage {
+	messages := s.conv.Request.Messages
+	n := 0
+	for n < len(messages) && messages[n].Role == openai.ChatMessageRoleSystem {
+		n++
+	}
+	return slices.Clone(messages[:n])
+}
@@ -0,0 +1,132 @@
+package complete
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pastdev/askai/pkg/attachment"
+	"github.com/pastdev/askai/pkg/log"
+	"github.com/pastdev/askai/pkg/tokenizer"
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/pflag"
+)
+
+// attachFlags are the flags controlling what is attached to the last user
+// message.
+type attachFlags struct {
+	binary    bool
+	detail    string
+	excludes  []string
+	images    []string
+	maxTokens int
+	paths     []string
+	report    bool
+}
+
+func (a *attachFlags) AddFlags(f *pflag.FlagSet) {
+	f.StringArrayVar(
+		&a.paths,
+		"attach",
+		[]string{},
+		""+
+			"An attachment to add to the user message, these attachments will be appended to the last user message. "+
+			"Text files are inlined in fenced blocks labeled with their path, images (png, jpeg, gif, webp) are sent as image parts that vision models can see, and all other files will be base64 encoded. "+
+			"Archives (zip, tar, tar.gz) named explicitly are expanded into their entries, and the text of pdf, html, and jupyter notebook files named explicitly is extracted, it is an error if that fails. "+
+			"The format of the attachment argument is [alias:]path where alias is optional and if not supplied the basename of path will be used. "+
+			"If path is a directory, the directory will be recursively walked and all files encountered will be included. "+
+			"If path is a glob pattern (** matches any number of directories), all matching files will be included. "+
+			"Files found by walking or globbing are skipped if ignored by a .gitignore (including those of parent directories up to the repository root), excluded by --attach-exclude, or binary other than images (see --attach-binary).")
+	f.BoolVar(
+		&a.binary,
+		"attach-binary",
+		false,
+		"Include binary files found when walking a directory or glob for --attach")
+	f.StringArrayVar(
+		&a.excludes,
+		"attach-exclude",
+		[]string{},
+		"A glob pattern for files and directories to skip when walking a directory or glob for --attach, patterns without a slash match the name at any depth")
+	f.IntVar(
+		&a.maxTokens,
+		"attach-max-tokens",
+		0,
+		"The maximum number of tokens for all --attach files combined, the largest files are truncated or skipped (with a warning) to fit")
+	f.BoolVar(
+		&a.report,
+		"attach-report",
+		false,
+		"Write the number of tokens used by each --attach file to stderr")
+	f.StringArrayVar(
+		&a.images,
+		"image",
+		[]string{},
+		"An image to add to the last user message as an image part, either a path to an image file or a http(s) or data URL")
+	f.StringVar(
+		&a.detail,
+		"image-detail",
+		"",
+		"The detail level vision models should use for images: auto, low, or high")
+}
+
+func (a *attachFlags) Empty() bool {
+	return len(a.paths) == 0 && len(a.images) == 0
+}
+
+// Parts returns the message parts for the attachments followed by the images.
+// The attachments are counted using the tokenizer for model to apply the
+// token budget and write the report.
+func (a *attachFlags) Parts(model string) ([]openai.ChatMessagePart, error) {
+	detail := openai.ImageURLDetail(a.detail)
+	switch detail {
+	case "", openai.ImageURLDetailAuto, openai.ImageURLDetailHigh, openai.ImageURLDetailLow:
+	default:
+		return nil, fmt.Errorf("unsupported image detail: %s", detail)
+	}
+
+	loadOpts := []attachment.LoadOption{attachment.WithExclude(a.excludes...)}
+	if a.binary {
+		loadOpts = append(loadOpts, attachment.WithBinary())
+	}
+
+	files, err := attachment.Load(a.paths, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("attachments: %w", err)
+	}
+
+	if a.report || a.maxTokens > 0 {
+		tkzr, err := tokenizer.NewTokenizer(model)
+		if err != nil {
+			log.Warn().Err(err).Str("model", model).Msg("no tokenizer for model, attachment tokens are approximate")
+			tkzr = tokenizer.ApproximateTokenizer{}
+		}
+
+		var report attachment.Report
+		files, report = attachment.Budget(files, tkzr, a.maxTokens)
+		for _, usage := range report {
+			if usage.Action != "" {
+				log.Warn().
+					Str("attachment", usage.Name).
+					Int("tokens", usage.Tokens).
+					Int("original", usage.Original).
+					Msgf("attachment %s to fit --attach-max-tokens", usage.Action)
+			}
+		}
+
+		if a.report {
+			err := report.Write(os.Stderr)
+			if err != nil {
+				return nil, fmt.Errorf("attachments: %w", err)
+			}
+		}
+	}
+
+	parts := attachment.Parts(files, detail)
+	for _, image := range a.images {
+		part, err := attachment.ImagePart(image, detail)
+		if err != nil {
+			return nil, fmt.Errorf("attachments: %w", err)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
@@ -1,85 +1,101 @@
 package complete
 
 import (
-	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 
 	"dario.cat/mergo"
 	"github.com/pastdev/askai/cmd/askai/config"
+	"github.com/pastdev/askai/pkg/attachment"
 	"github.com/pastdev/askai/pkg/chatcompletion"
 	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
 
-func encodeAttachments(attachements []string) (string, error) {
-	var data strings.Builder
-	for _, attachment := range attachements {
-		parts := strings.Split(attachment, ":")
-		var filename string
-		var path string
-		switch len(parts) {
-		case 1:
-			path = parts[0]
-			filename = filepath.Base(parts[0])
-		default:
-			filename = parts[0]
-			path = parts[1]
+// colorEnabled returns true if f is a terminal and NO_COLOR is not set:
+//
+//	https://no-color.org/
+func colorEnabled(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// promptMessages renders the named prompt with vars in the form name=value.
+func promptMessages(
+	cfg *config.Config,
+	name string,
+	vars []string,
+) ([]openai.ChatCompletionMessage, error) {
+	c, err := cfg.Config()
+	if err != nil {
+		return nil, fmt.Errorf("prompt config: %w", err)
+	}
+
+	prompt, err := c.Prompt(name)
+	if err != nil {
+		return nil, fmt.Errorf("prompt: %w", err)
+	}
+
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("prompt var %s: expected name=value", v)
 		}
 
-		info, err := os.Stat(path)
+		value, err := resolveContent(value)
 		if err != nil {
-			return "", fmt.Errorf("stat attachment: %w", err)
+			return nil, fmt.Errorf("prompt var %s: %w", key, err)
 		}
-		if info.IsDir() {
-			err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
-				if err != nil {
-					return err
-				}
-				if !d.IsDir() {
-					//nolint: gosec // the intent is to include a file from a user supplied location
-					content, err := os.ReadFile(path)
-					if err != nil {
-						return fmt.Errorf("read attachment: %w", err)
-					}
-
-					data.WriteString(
-						fmt.Sprintf(
-							"%s: %s\n",
-							path,
-							base64.StdEncoding.EncodeToString(content)))
-				}
-				return nil
-			})
-			if err != nil {
-				return "", fmt.Errorf("attachment walk: %w", err)
-			}
-		} else {
-			//nolint: gosec // the intent is to include a file from a user supplied location
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return "", fmt.Errorf("read attachment: %w", err)
-			}
+		values[key] = value
+	}
 
-			data.WriteString(
-				fmt.Sprintf("%s: %s\n", filename, base64.StdEncoding.EncodeToString(content)))
-		}
+	messages, err := prompt.Messages(values)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", name, err)
 	}
-	return data.String(), nil
+	return messages, nil
+}
+
+// requestFlags are the flags bound to fields of the request other than
+// messages, they take precedence over --request-file.
+var requestFlags = []string{
+	"logprobs",
+	"max-completion-tokens",
+	"max-tokens",
+	"model",
+	"n",
+	"stream",
+	"temperature",
+	"top-logprobs",
 }
 
 func New(cfg *config.Config) *cobra.Command {
 	var req openai.ChatCompletionRequest
 	var conversation string
+	var edit bool
 	var logItBias string
+	var messagesFiles []string
+	var requestFile string
 	var output string
-	var attachments []string
+	var attach attachFlags
+	var usage bool
+	var saveChoice int
+	var logProbsTable bool
+	var responseTemplate string
+	var responseTemplateFile string
+	var chunkTemplate string
+	var reasoning string
+	var saveReasoning bool
+	var noStdin bool
+	var prompt string
+	var promptVars []string
 
 	cmd := cobra.Command{
 		Use:   "complete",
@@ -92,11 +108,47 @@ func New(cfg *config.Config) *cobra.Command {
     --conversation life_the_world_and_everything \
     --user "what is the meaning of life, the world, and everything?"
 
+  # ask about piped content
+  git diff | askai complete --user "review this diff"
+
+  # write a long question in $EDITOR
+  askai complete --conversation myconv --edit
+
+  # replay a request checked into git, overriding the model
+  askai complete --request-file request.yaml --model gpt-4o
+
+  # use few-shot examples from a file
+  askai complete --messages-file examples.yaml --user "translate: good night"
+
+  # read the system prompt from a file and the question from stdin
+  askai complete --system @reviewer.txt --user - < question.txt
+
+  # use a prompt template from the config
+  askai complete --prompt review --var lang=go --var file=@main.go
+
+  # use the endpoint and request settings of a preset from the config
+  git diff | askai complete --preset reviewer
+
+  # review a directory, skipping tests
+  askai complete --user "review this code" --attach ./pkg --attach-exclude '*_test.go'
+
+  # see how many tokens each file uses while limiting the total
+  askai complete --user "review this code" --attach ./pkg --attach-report --attach-max-tokens 50000
+
+  # ask a vision model about an image
+  askai complete --user "what is in this picture?" --image cat.png
+
   # get your answer from a frat boy
   askai complete \
     --system "you are a frat boy during peak frat" \
     --user "whats the best beer for a night at the sorority?"
 
+  # generate a commit message from the staged changes
+  askai complete \
+    --output template \
+    --template '{{ (index .Response.Choices 0).Message.Content | trim }}{{ "\n" }}' \
+    --user "write a commit message for this diff: $(git diff --staged)"
+
   # create a short story about foo without using "foo"
   askai complete \
     --logit-bias "$(
@@ -116,13 +168,51 @@ func New(cfg *config.Config) *cobra.Command {
 			}
 
 			client := endpoint.NewClient()
-			ctx := context.Background()
 
-			defaults := openai.ChatCompletionRequest{}
-			if endpoint.ChatCompletionDefaults != nil {
-				defaults = *endpoint.ChatCompletionDefaults
+			defaults, err := cfg.ChatCompletionDefaults(endpoint)
+			if err != nil {
+				return err
 			}
 
+			// flags take precedence over the request file, which takes
+			// precedence over the preset, which takes precedence over the
+			// endpoint defaults. messages are not merged, they are added in
+			// order: request file, messages files, then flags
+			var fileMessages []openai.ChatCompletionMessage
+			if requestFile != "" {
+				fileReq, err := chatcompletion.ReadRequestFile(requestFile)
+				if err != nil {
+					return err
+				}
+				fileMessages = fileReq.Messages
+				fileReq.Messages = req.Messages
+
+				// merging would not let a flag set a zero value such as
+				// --stream=false, so the request file replaces the request
+				// and the flags that were set are applied again
+				flagValues := map[string]string{}
+				for _, name := range requestFlags {
+					if cmd.Flags().Changed(name) {
+						flagValues[name] = cmd.Flags().Lookup(name).Value.String()
+					}
+				}
+				req = fileReq
+				for name, value := range flagValues {
+					err := cmd.Flags().Set(name, value)
+					if err != nil {
+						return fmt.Errorf("apply --%s over request file: %w", name, err)
+					}
+				}
+			}
+			for _, path := range messagesFiles {
+				messages, err := chatcompletion.ReadMessagesFile(path)
+				if err != nil {
+					return err
+				}
+				fileMessages = append(fileMessages, messages...)
+			}
+			req.Messages = append(fileMessages, req.Messages...)
+
 			if logItBias != "" {
 				err := json.Unmarshal([]byte(logItBias), &req.LogitBias)
 				if err != nil {
@@ -134,41 +224,160 @@ func New(cfg *config.Config) *cobra.Command {
 				req.LogProbs = true
 			}
 
-			if req.LogProbs {
+			if req.LogProbs && !cmd.Flags().Changed("output") {
 				// obviously cant use "content" for output or you wouldn't see
 				// the log probs you explicitly asked for
-				output = "raw"
+				output = "logprobs"
 			}
 
 			var writer chatcompletion.ResponseWriter
 			switch output {
 			case "content":
 				writer = &chatcompletion.ContentResponseWriter{W: os.Stdout}
+			case "logprobs":
+				writer = &chatcompletion.LogProbsResponseWriter{
+					NoColor: !colorEnabled(os.Stdout),
+					Table:   logProbsTable,
+					W:       os.Stdout,
+				}
 			case "raw":
 				writer = &chatcompletion.RawResponseWriter{W: os.Stdout}
 			case "recap":
 				writer = &chatcompletion.RecapResponseWriter{W: os.Stdout}
+			case "template":
+				if responseTemplateFile != "" {
+					//nolint: gosec // the intent is to read a template from a user supplied location
+					data, err := os.ReadFile(responseTemplateFile)
+					if err != nil {
+						return fmt.Errorf("read template file: %w", err)
+					}
+					responseTemplate = string(data)
+				}
+				if responseTemplate == "" && chunkTemplate == "" {
+					return errors.New("--output template requires --template, --template-file, or --chunk-template")
+				}
+				writer, err = chatcompletion.NewTemplateResponseWriter(
+					os.Stdout,
+					responseTemplate,
+					chunkTemplate)
+				if err != nil {
+					return fmt.Errorf("template writer: %w", err)
+				}
+			default:
+				return fmt.Errorf("unsupported output: %s", output)
+			}
+
+			switch chatcompletion.ReasoningMode(reasoning) {
+			case chatcompletion.ReasoningHide,
+				chatcompletion.ReasoningShow,
+				chatcompletion.ReasoningStderr:
+				// raw output is the response as the server sent it unless
+				// --reasoning asks for something else
+				if output != "raw" || cmd.Flags().Changed("reasoning") {
+					writer = chatcompletion.NewReasoningResponseWriter(
+						writer,
+						chatcompletion.ReasoningMode(reasoning),
+						os.Stderr)
+				}
+			default:
+				return fmt.Errorf("unsupported reasoning: %s", reasoning)
+			}
+
+			var usageAccumulator *chatcompletion.ResponseWriterUsageAccumulator
+			if usage {
+				usageAccumulator = chatcompletion.NewResponseWriterUsageAccumulator(writer)
+				writer = usageAccumulator
+				if req.Stream {
+					req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+				}
+			}
+
+			if prompt != "" {
+				messages, err := promptMessages(cfg, prompt, promptVars)
+				if err != nil {
+					return err
+				}
+				req.Messages = append(messages, req.Messages...)
 			}
 
-			if len(attachments) > 0 {
+			if !noStdin && stdin.Piped() {
+				content, err := stdin.ReadAll()
+				if err != nil {
+					return fmt.Errorf("piped user message: %w", err)
+				}
+				req.Messages = append(
+					req.Messages,
+					openai.ChatCompletionMessage{
+						Role:    openai.ChatMessageRoleUser,
+						Content: content,
+					})
+			}
+
+			if edit {
+				history := append(slices.Clone(defaults.Messages), req.Messages...)
+				if conversation != "" {
+					conv, err := chatcompletion.LoadPersistentConversation(conversation, defaults)
+					if err != nil {
+						return fmt.Errorf("load %s: %w", conversation, err)
+					}
+					history = append(conv.Request().Messages, req.Messages...)
+				}
+
+				var system []openai.ChatCompletionMessage
+				var turns []openai.ChatCompletionMessage
+				for _, msg := range history {
+					if msg.Role == openai.ChatMessageRoleSystem {
+						system = append(system, msg)
+					} else if conversation != "" {
+						turns = append(turns, msg)
+					}
+				}
+
+				content, err := editMessage(system, turns)
+				if err != nil {
+					return err
+				}
+				req.Messages = append(
+					req.Messages,
+					openai.ChatCompletionMessage{
+						Role:    openai.ChatMessageRoleUser,
+						Content: content,
+					})
+			}
+
+			model := req.Model
+			if model == "" {
+				model = defaults.Model
+			}
+
+			if !attach.Empty() {
+				parts, err := attach.Parts(model)
+				if err != nil {
+					return err
+				}
+
 				for i := len(req.Messages) - 1; true; i-- {
 					if i < 0 {
-						return errors.New("no user message to append attements to")
+						return errors.New("no user message to append attachments to")
 					}
 					if req.Messages[i].Role == openai.ChatMessageRoleUser {
-						data, err := encodeAttachments(attachments)
-						if err != nil {
-							return err
-						}
-						req.Messages[i].Content = fmt.Sprintf(
-							"%s\n\n########## base64 encoded attachments ##########\n%s",
-							req.Messages[i].Content,
-							data)
+						attachment.AppendParts(&req.Messages[i], parts)
 						break
 					}
 				}
 			}
 
+			// the upper bound depends on the n of the conversation which is
+			// checked by SendReply
+			if saveChoice < 0 {
+				return fmt.Errorf("save choice %d is negative", saveChoice)
+			}
+
+			// the timeout starts now rather than while the message is being
+			// written or read from stdin
+			ctx, cancel := cfg.Context()
+			defer cancel()
+
 			if conversation == "" {
 				err := mergo.Merge(&req, defaults)
 				if err != nil {
@@ -186,34 +395,54 @@ func New(cfg *config.Config) *cobra.Command {
 					return fmt.Errorf("load %s: %w", conversation, err)
 				}
 
+				replyOpts := []chatcompletion.SendReplyOption{chatcompletion.WithChoice(saveChoice)}
+				if saveReasoning {
+					replyOpts = append(replyOpts, chatcompletion.WithReasoning())
+				}
+
 				err = chatcompletion.SendReply(
 					ctx,
 					client,
 					&conv,
 					req,
-					writer)
+					writer,
+					replyOpts...)
 				if err != nil {
 					return fmt.Errorf("complete chat: %w", err)
 				}
 			}
 
+			if usageAccumulator != nil {
+				err := usageAccumulator.WriteSummary(os.Stderr, endpoint.ModelPricing)
+				if err != nil {
+					return fmt.Errorf("usage summary: %w", err)
+				}
+			}
+
 			return nil
 		},
 	}
 
-	cmd.Flags().StringArrayVar(
-		&attachments,
-		"attach",
-		[]string{},
+	attach.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(
+		&chunkTemplate,
+		"chunk-template",
+		"",
 		""+
-			"An attachment to add to the user message, these attachments will be base64 encoded and appended to the last user message. "+
-			"The format of the attachment argument is [alias:]path where alias is optional and if not supplied the basename of path will be used. "+
-			"If path is a directory, the directory will be recursively walked and all files encountered will be included.")
+			"A go text/template rendered for each chunk of a streamed response when using --output template. "+
+			"The data is the same as for --template with the addition of .Chunk (openai.ChatCompletionStreamResponse)")
 	cmd.Flags().StringVar(
 		&conversation,
 		"conversation",
 		"",
 		"A named conversation to start or continue")
+	cmd.Flags().BoolVar(
+		&edit,
+		"edit",
+		false,
+		""+
+			"Write the user message in $VISUAL or $EDITOR, which is opened on a template showing the system messages "+
+			"and, with --conversation, the last few turns. An empty message cancels the request")
 	cmd.Flags().StringVar(
 		&logItBias,
 		"logit-bias",
@@ -224,6 +453,11 @@ func New(cfg *config.Config) *cobra.Command {
 		"logprobs",
 		false,
 		"Returns the log probabilities of each output token returned in the content of message")
+	cmd.Flags().BoolVar(
+		&logProbsTable,
+		"logprobs-table",
+		false,
+		"When using --output logprobs, also write a table of the top alternatives at each token position (use with --top-logprobs)")
 	cmd.Flags().IntVar(
 		&req.MaxTokens,
 		"max-tokens",
@@ -246,7 +480,7 @@ func New(cfg *config.Config) *cobra.Command {
 		"message",
 		"m",
 		nil,
-		"One or more complete json messages")
+		"One or more complete json messages (- reads stdin, @path reads a file, @@ escapes a leading @)")
 	MessageArrayVarP(
 		cmd.Flags(),
 		"user",
@@ -254,7 +488,9 @@ func New(cfg *config.Config) *cobra.Command {
 		"user",
 		"u",
 		nil,
-		"One or more user content messages")
+		""+
+			"One or more user content messages (- reads stdin, @path reads a file, @@ escapes a leading @). "+
+			"If stdin is piped, it is added as an additional user message unless --no-stdin is set")
 	MessageArrayVarP(
 		cmd.Flags(),
 		"system",
@@ -262,7 +498,7 @@ func New(cfg *config.Config) *cobra.Command {
 		"system",
 		"s",
 		nil,
-		"One or more system content messages")
+		"One or more system content messages (- reads stdin, @path reads a file, @@ escapes a leading @)")
 	MessageArrayVarP(
 		cmd.Flags(),
 		"assistant",
@@ -270,23 +506,93 @@ func New(cfg *config.Config) *cobra.Command {
 		"assistant",
 		"a",
 		nil,
-		"One or more assistant content messages")
+		"One or more assistant content messages (- reads stdin, @path reads a file, @@ escapes a leading @)")
+	cmd.Flags().StringArrayVar(
+		&messagesFiles,
+		"messages-file",
+		[]string{},
+		"A YAML or JSON file containing an array of messages, added after those of --request-file and before those of other flags")
+	cmd.Flags().IntVar(
+		&req.N,
+		"n",
+		0,
+		"How many chat completion choices to generate, each choice is labeled in the output")
+	cmd.Flags().BoolVar(
+		&noStdin,
+		"no-stdin",
+		false,
+		"Do not add piped stdin as a user message")
+	cmd.Flags().StringVar(
+		&prompt,
+		"prompt",
+		"",
+		"A named prompt template from the config whose messages are added ahead of any other messages (see: askai prompts list)")
 	cmd.Flags().StringVar(
 		&output,
 		"output",
 		"content",
-		"Format of output, one of: content, raw, recap")
+		"Format of output, one of: content, logprobs, raw, recap, template (defaults to logprobs when --logprobs is set)")
+	cmd.Flags().StringVar(
+		&requestFile,
+		"request-file",
+		"",
+		""+
+			"A YAML or JSON file containing a complete chat completion request. "+
+			"Values set by flags take precedence over the request file, which takes precedence over the preset and endpoint defaults. "+
+			"Its messages follow those of --prompt and come before those of --messages-file and other flags")
+	cmd.Flags().StringVar(
+		&reasoning,
+		"reasoning",
+		string(chatcompletion.ReasoningShow),
+		""+
+			"What to do with the reasoning (<think> blocks or reasoning_content) of reasoning models, one of: show, hide, stderr. "+
+			"With --output raw the response is written as received unless this is set. "+
+			"Reasoning is not saved to conversations unless --save-reasoning is set")
+	cmd.Flags().IntVar(
+		&saveChoice,
+		"save-choice",
+		0,
+		"The index of the choice to save to the conversation when --n is greater than 1")
+	cmd.Flags().BoolVar(
+		&saveReasoning,
+		"save-reasoning",
+		false,
+		"Save the reasoning of the response to the conversation along with the content")
 	cmd.Flags().BoolVar(
 		&req.Stream,
 		"stream",
 		false,
 		"Stream the response")
+	cmd.Flags().BoolVar(
+		&usage,
+		"usage",
+		false,
+		"Print a summary of token usage, and cost if pricing is configured for the model, to stderr")
+	cmd.Flags().StringVar(
+		&responseTemplate,
+		"template",
+		"",
+		""+
+			"A go text/template rendered for each response when using --output template. "+
+			"The data has .Request (openai.ChatCompletionRequest), .Response (openai.ChatCompletionResponse, accumulated from the chunks when streaming), "+
+			"and .Timing (.Start, .Elapsed, and .FirstChunk). "+
+			"In addition to the builtins, the functions csv, json, and trim are available")
+	cmd.Flags().StringVar(
+		&responseTemplateFile,
+		"template-file",
+		"",
+		"A file containing the --template")
 	cmd.Flags().Float32VarP(
 		&req.Temperature,
 		"temperature",
 		"t",
 		0,
 		"Temperature, zero is not set, so if you want zero, use 0.0000001 or similar")
+	cmd.Flags().StringArrayVar(
+		&promptVars,
+		"var",
+		[]string{},
+		"A variable for the --prompt template in the form name=value (value may be - to read stdin or @path to read a file)")
 	cmd.Flags().IntVar(
 		&req.TopLogProbs,
 		"top-logprobs",
@@ -0,0 +1,81 @@
+package complete
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+)
+
+// editMessage opens the editor on a template listing the system messages
+// and the last few turns of history, and returns the message that was
+// written above the scissors line.
+func editMessage(system, history []openai.ChatCompletionMessage) (string, error) {
+	f, err := os.CreateTemp("", "askai-message-*.md")
+	if err != nil {
+		return "", fmt.Errorf("edit: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.WriteString(chatcompletion.EditTemplate(system, history))
+	if err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("edit write template: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return "", fmt.Errorf("edit close template: %w", err)
+	}
+
+	err = runEditor(f.Name())
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("edit read message: %w", err)
+	}
+	return chatcompletion.ParseEditedMessage(string(data))
+}
+
+// editorCommand returns the command line of the editor to use from VISUAL or
+// EDITOR, falling back to vi.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// runEditor runs the editor on path attached to the terminal. If stdin has
+// been piped, the editor reads from the controlling terminal instead.
+func runEditor(path string) error {
+	editor := editorCommand()
+
+	//nolint: gosec // the intent is to run the editor the user configured
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if !isTerminal(os.Stdin) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return fmt.Errorf("edit open terminal: %w", err)
+		}
+		defer func() { _ = tty.Close() }()
+		cmd.Stdin = tty
+		cmd.Stdout = tty
+	}
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("edit run %s: %w", editor[0], err)
+	}
+	return nil
+}
@@ -2,13 +2,20 @@ package complete
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/pastdev/askai/pkg/log"
 	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/pflag"
 )
 
+// stdin is shared by all of the message flags as it can only be read once.
+var stdin = &stdinSource{file: os.Stdin}
+
 type messageArrayValue struct {
 	msgs *[]openai.ChatCompletionMessage
 	role string
@@ -32,7 +39,19 @@ func (m *messageArrayValue) String() string {
 	return string(msgs)
 }
 
+type stdinSource struct {
+	file *os.File
+	read bool
+}
+
+// Set adds a message. The value may be - to read the content from stdin, or
+// @path to read it from a file. A leading @ can be escaped as @@.
 func (m *messageArrayValue) Set(v string) error {
+	v, err := resolveContent(v)
+	if err != nil {
+		return err
+	}
+
 	var msg openai.ChatCompletionMessage
 	if m.role == "" {
 		err := json.Unmarshal([]byte(v), &msg)
@@ -61,6 +80,57 @@ func (*messageArrayValue) Type() string {
 	return "messages"
 }
 
+// Piped returns true if stdin has not been read and is not a terminal,
+// meaning something was piped or redirected into it.
+func (s *stdinSource) Piped() bool {
+	return !s.read && !isTerminal(s.file)
+}
+
+func (s *stdinSource) ReadAll() (string, error) {
+	if s.read {
+		return "", errors.New("stdin can only be read once")
+	}
+	s.read = true
+
+	data, err := io.ReadAll(s.file)
+	if err != nil {
+		return "", fmt.Errorf("read stdin: %w", err)
+	}
+	return string(data), nil
+}
+
+// isTerminal returns true if f is a terminal. Note that /dev/null is a
+// character device, so it is treated like a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func resolveContent(v string) (string, error) {
+	switch {
+	case v == "-":
+		content, err := stdin.ReadAll()
+		if err != nil {
+			return "", fmt.Errorf("message content: %w", err)
+		}
+		return content, nil
+	case strings.HasPrefix(v, "@@"):
+		return v[1:], nil
+	case strings.HasPrefix(v, "@"):
+		//nolint: gosec // the intent is to include a file from a user supplied location
+		content, err := os.ReadFile(v[1:])
+		if err != nil {
+			return "", fmt.Errorf("message content (use @@ to start a message with a literal @): %w", err)
+		}
+		return string(content), nil
+	default:
+		return v, nil
+	}
+}
+
 func MessageArrayVar(
 	f *pflag.FlagSet,
 	role string,
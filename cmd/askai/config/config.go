@@ -1,12 +1,19 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"text/tabwriter"
+	"time"
 
 	pkgcfg "github.com/pastdev/askai/pkg/config"
 	cobracfg "github.com/pastdev/configloader/pkg/cobra"
 	cfgldr "github.com/pastdev/configloader/pkg/config"
+	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +26,8 @@ const (
 type Config struct {
 	configSource cobracfg.ConfigLoader[pkgcfg.Config]
 	endpoint     string
+	preset       string
+	timeout      time.Duration
 }
 
 func (c *Config) Config() (*pkgcfg.Config, error) {
@@ -29,13 +38,42 @@ func (c *Config) Config() (*pkgcfg.Config, error) {
 	return cfg, nil
 }
 
+// Context returns the context for requests of a command. It is cancelled by
+// Ctrl-C (SIGINT) and when the --timeout, if any, expires. The timeout starts
+// when it is called so it should be called just before the requests are
+// sent. Once it is done, Ctrl-C is no longer handled so that a second one
+// kills a process that is stuck.
+func (c *Config) Context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	cancel := stop
+	if c.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, c.timeout)
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, cancel
+}
+
 func (c *Config) EndpointConfig() (*pkgcfg.EndpointConfig, error) {
 	cfg, err := c.Config()
 	if err != nil {
 		return nil, fmt.Errorf("endpointconfig load config: %w", err)
 	}
 
-	endpoint, err := cfg.EndpointConfig(c.endpoint)
+	name, err := c.EndpointName()
+	if err != nil {
+		return nil, fmt.Errorf("endpointconfig: %w", err)
+	}
+
+	endpoint, err := cfg.EndpointConfig(name)
 	if err != nil {
 		return nil, fmt.Errorf("endpointconfig client config: %w", err)
 	}
@@ -43,6 +81,66 @@ func (c *Config) EndpointConfig() (*pkgcfg.EndpointConfig, error) {
 	return endpoint, nil
 }
 
+// ChatCompletionDefaults returns the chat completion defaults of endpoint
+// with the settings of the --preset, if any, taking precedence.
+func (c *Config) ChatCompletionDefaults(endpoint *pkgcfg.EndpointConfig) (openai.ChatCompletionRequest, error) {
+	defaults := openai.ChatCompletionRequest{}
+	if endpoint.ChatCompletionDefaults != nil {
+		defaults = *endpoint.ChatCompletionDefaults
+	}
+
+	preset, err := c.Preset()
+	if err != nil || preset == nil {
+		return defaults, err
+	}
+
+	defaults, err = preset.ChatCompletionDefaults(defaults)
+	if err != nil {
+		return defaults, fmt.Errorf("chat completion defaults: %w", err)
+	}
+	return defaults, nil
+}
+
+// EndpointName returns the name of the endpoint in use, which is the one
+// selected, the endpoint of the preset, or the default endpoint.
+func (c *Config) EndpointName() (string, error) {
+	if c.endpoint != "" {
+		return c.endpoint, nil
+	}
+
+	cfg, err := c.Config()
+	if err != nil {
+		return "", fmt.Errorf("endpointname load config: %w", err)
+	}
+
+	preset, err := c.Preset()
+	if err != nil {
+		return "", fmt.Errorf("endpointname: %w", err)
+	}
+	if preset != nil && preset.Endpoint != "" {
+		return preset.Endpoint, nil
+	}
+	return cfg.DefaultEndpoint, nil
+}
+
+// Preset returns the preset selected with --preset, or nil if none was.
+func (c *Config) Preset() (*pkgcfg.PresetConfig, error) {
+	if c.preset == "" {
+		return nil, nil
+	}
+
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, fmt.Errorf("preset load config: %w", err)
+	}
+
+	preset, err := cfg.Preset(c.preset)
+	if err != nil {
+		return nil, fmt.Errorf("preset: %w", err)
+	}
+	return preset, nil
+}
+
 func (c *Config) AddConfigCommandTo(root *cobra.Command) {
 	c.configSource.AddSubCommandTo(
 		root,
@@ -56,7 +154,8 @@ func (c *Config) AddConfigCommandTo(root *cobra.Command) {
 					}
 				}
 				return nil
-			}))
+			}),
+		cobracfg.WithConfigCommandOutput("presets", printPresets))
 }
 
 func AddConfig(root *cobra.Command) *Config {
@@ -91,7 +190,8 @@ func AddConfig(root *cobra.Command) *Config {
 					}
 				}
 				return nil
-			}))
+			}),
+		cobracfg.WithConfigCommandOutput("presets", printPresets))
 
 	cfg.configSource.PersistentFlags(root).FileSourceVarP(
 		cfgldr.YamlUnmarshal[pkgcfg.Config](),
@@ -104,6 +204,46 @@ func AddConfig(root *cobra.Command) *Config {
 		"d",
 		"location of one or more config directories")
 	root.PersistentFlags().StringVar(&cfg.endpoint, "endpoint", "", "the endpoint to use")
+	root.PersistentFlags().StringVar(
+		&cfg.preset,
+		"preset",
+		"",
+		"a preset of endpoint and request settings to use, flags take precedence over its settings")
+	root.PersistentFlags().DurationVar(
+		&cfg.timeout,
+		"timeout",
+		0,
+		"the maximum time for the requests of a command (e.g. 30s or 5m), 0 for no limit")
 
 	return &cfg
 }
+
+// printPresets lists the configured presets along with their endpoints and
+// descriptions.
+func printPresets(w io.Writer, cfg *pkgcfg.Config) error {
+	names := make([]string, 0, len(cfg.Presets))
+	for name := range cfg.Presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		preset := cfg.Presets[name]
+		endpoint := preset.Endpoint
+		if endpoint == "" {
+			endpoint = cfg.DefaultEndpoint
+		}
+
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", name, endpoint, preset.Description)
+		if err != nil {
+			return fmt.Errorf("print: %w", err)
+		}
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return fmt.Errorf("print: %w", err)
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package embedding
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -27,7 +26,8 @@ func New(cfg *config.Config) *cobra.Command {
 			}
 
 			client := endpoint.NewClient()
-			ctx := context.Background()
+			ctx, cancel := cfg.Context()
+			defer cancel()
 
 			req := openai.EmbeddingRequest{
 				Model: openai.EmbeddingModel(model),
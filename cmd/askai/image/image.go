@@ -1,7 +1,6 @@
 package image
 
 import (
-	"context"
 	"fmt"
 	"os"
 
@@ -34,7 +33,8 @@ func New(cfg *config.Config) *cobra.Command {
 			}
 
 			client := endpoint.NewClient()
-			ctx := context.Background()
+			ctx, cancel := cfg.Context()
+			defer cancel()
 
 			defaults := openai.ImageRequest{}
 			if endpoint.ImageDefaults != nil {
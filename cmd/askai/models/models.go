@@ -1,15 +1,22 @@
 package models
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 
 	"github.com/pastdev/askai/cmd/askai/config"
+	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
 
+// azureModels is the model list of an azure endpoint along with the
+// deployments models are mapped to, which the api does not list.
+type azureModels struct {
+	openai.ModelsList
+	Deployments map[string]string `json:"deployments"`
+}
+
 func New(cfg *config.Config) *cobra.Command {
 	var modelID string
 
@@ -24,12 +31,18 @@ func New(cfg *config.Config) *cobra.Command {
 			}
 
 			client := endpoint.NewClient()
-			ctx := context.Background()
+			ctx, cancel := cfg.Context()
+			defer cancel()
 
 			var res any
-			if modelID == "" {
+			switch {
+			case modelID == "" && len(endpoint.AzureDeployments) > 0:
+				var list openai.ModelsList
+				list, err = client.ListModels(ctx)
+				res = azureModels{ModelsList: list, Deployments: endpoint.AzureDeployments}
+			case modelID == "":
 				res, err = client.ListModels(ctx)
-			} else {
+			default:
 				res, err = client.GetModel(ctx, url.QueryEscape(modelID))
 			}
 			if err != nil {
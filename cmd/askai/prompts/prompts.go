@@ -0,0 +1,130 @@
+package prompts
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pastdev/askai/cmd/askai/config"
+	"github.com/spf13/cobra"
+)
+
+func New(cfg *config.Config) *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "prompts",
+		Short: `List and show the configured prompt templates`,
+	}
+
+	cmd.AddCommand(NewList(cfg))
+	cmd.AddCommand(NewShow(cfg))
+
+	return &cmd
+}
+
+func NewList(cfg *config.Config) *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "list",
+		Short: `List the configured prompt templates`,
+		//nolint: revive // required to match upstream signature
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := cfg.Config()
+			if err != nil {
+				return fmt.Errorf("list: %w", err)
+			}
+
+			names := make([]string, 0, len(c.Prompts))
+			for name := range c.Prompts {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, name := range names {
+				_, err := fmt.Fprintf(w, "%s\t%s\n", name, c.Prompts[name].Description)
+				if err != nil {
+					return fmt.Errorf("print: %w", err)
+				}
+			}
+
+			err = w.Flush()
+			if err != nil {
+				return fmt.Errorf("print: %w", err)
+			}
+			return nil
+		},
+	}
+
+	return &cmd
+}
+
+func NewShow(cfg *config.Config) *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "show <name>",
+		Short: `Show a configured prompt template and its variables`,
+		Args:  cobra.ExactArgs(1),
+		//nolint: revive // required to match upstream signature
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := cfg.Config()
+			if err != nil {
+				return fmt.Errorf("show: %w", err)
+			}
+
+			prompt, err := c.Prompt(args[0])
+			if err != nil {
+				return fmt.Errorf("show: %w", err)
+			}
+
+			var out strings.Builder
+			fmt.Fprintf(&out, "name: %s\n", args[0])
+			if prompt.Description != "" {
+				fmt.Fprintf(&out, "description: %s\n", prompt.Description)
+			}
+
+			if len(prompt.Variables) > 0 {
+				names := make([]string, 0, len(prompt.Variables))
+				for name := range prompt.Variables {
+					names = append(names, name)
+				}
+				slices.Sort(names)
+
+				out.WriteString("variables:\n")
+				for _, name := range names {
+					variable := prompt.Variables[name]
+					var qualifier string
+					switch {
+					case variable.Required:
+						qualifier = " (required)"
+					case variable.Default != "":
+						qualifier = fmt.Sprintf(" (default: %s)", variable.Default)
+					}
+					fmt.Fprintf(&out, "  %s%s: %s\n", name, qualifier, variable.Description)
+				}
+			}
+
+			if prompt.System != "" {
+				fmt.Fprintf(&out, "system:\n%s\n", indent(prompt.System))
+			}
+			if prompt.User != "" {
+				fmt.Fprintf(&out, "user:\n%s\n", indent(prompt.User))
+			}
+
+			_, err = fmt.Print(out.String())
+			if err != nil {
+				return fmt.Errorf("print: %w", err)
+			}
+			return nil
+		},
+	}
+
+	return &cmd
+}
+
+func indent(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n")
+}
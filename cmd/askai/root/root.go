@@ -1,11 +1,13 @@
 package root
 
 import (
+	"github.com/pastdev/askai/cmd/askai/chat"
 	"github.com/pastdev/askai/cmd/askai/complete"
 	cmdcfg "github.com/pastdev/askai/cmd/askai/config"
 	"github.com/pastdev/askai/cmd/askai/embedding"
 	"github.com/pastdev/askai/cmd/askai/image"
 	"github.com/pastdev/askai/cmd/askai/models"
+	"github.com/pastdev/askai/cmd/askai/prompts"
 	"github.com/pastdev/askai/cmd/askai/tokens"
 	"github.com/pastdev/askai/cmd/askai/version"
 	"github.com/pastdev/askai/pkg/log"
@@ -33,10 +35,12 @@ func New() *cobra.Command {
 	cmd.PersistentFlags().StringVar(&logLevel, "log", "info", "log level")
 	cmd.PersistentFlags().StringVar(&logFormat, "log-format", "pretty", "log format (pretty|json)")
 
+	cmd.AddCommand(chat.New(cfg))
 	cmd.AddCommand(complete.New(cfg))
 	cmd.AddCommand(embedding.New(cfg))
 	cmd.AddCommand(image.New(cfg))
 	cmd.AddCommand(models.New(cfg))
+	cmd.AddCommand(prompts.New(cfg))
 	cmd.AddCommand(tokens.New())
 	cmd.AddCommand(version.New())
 
@@ -0,0 +1,396 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// defaultMaxTokens is used when the request does not set a max as the
+	// messages api requires one.
+	defaultMaxTokens = 4096
+)
+
+// thinkingBudgets maps the reasoning effort of a request to the number of
+// tokens extended thinking may use.
+var thinkingBudgets = map[string]int{
+	"low":    1024,
+	"medium": 4096,
+	"high":   16384,
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image
+	Source *imageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	Name  string          `json:"name,omitempty"`
+
+	// tool_result
+	Content   string `json:"content,omitempty"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+
+	// thinking
+	Thinking string `json:"thinking,omitempty"`
+}
+
+type errorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type imageSource struct {
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+}
+
+type message struct {
+	Content []contentBlock `json:"content"`
+	Role    string         `json:"role"`
+}
+
+type messagesRequest struct {
+	MaxTokens     int         `json:"max_tokens"`
+	Messages      []message   `json:"messages"`
+	Metadata      *metadata   `json:"metadata,omitempty"`
+	Model         string      `json:"model"`
+	StopSequences []string    `json:"stop_sequences,omitempty"`
+	Stream        bool        `json:"stream,omitempty"`
+	System        string      `json:"system,omitempty"`
+	Temperature   *float32    `json:"temperature,omitempty"`
+	Thinking      *thinking   `json:"thinking,omitempty"`
+	ToolChoice    *toolChoice `json:"tool_choice,omitempty"`
+	Tools         []tool      `json:"tools,omitempty"`
+	TopP          *float32    `json:"top_p,omitempty"`
+}
+
+type messagesResponse struct {
+	Content    []contentBlock `json:"content"`
+	ID         string         `json:"id"`
+	Model      string         `json:"model"`
+	StopReason string         `json:"stop_reason"`
+	Usage      usage          `json:"usage"`
+}
+
+type metadata struct {
+	UserID string `json:"user_id"`
+}
+
+type thinking struct {
+	BudgetTokens int    `json:"budget_tokens"`
+	Type         string `json:"type"`
+}
+
+type tool struct {
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+	Name        string `json:"name"`
+}
+
+type toolChoice struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+type usage struct {
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+// toMessagesRequest converts a chat completion request to a messages request.
+// System messages become the system prompt, tool results become user
+// messages, and consecutive messages of the same role are combined as the
+// messages api requires roles to alternate.
+func toMessagesRequest(req openai.ChatCompletionRequest) (messagesRequest, error) {
+	if req.N > 1 {
+		return messagesRequest{}, errors.New("n greater than 1 is not supported")
+	}
+
+	mreq := messagesRequest{
+		MaxTokens:     req.MaxCompletionTokens,
+		Model:         req.Model,
+		StopSequences: req.Stop,
+		Stream:        req.Stream,
+	}
+	if mreq.MaxTokens == 0 {
+		mreq.MaxTokens = req.MaxTokens
+	}
+	if mreq.MaxTokens == 0 {
+		mreq.MaxTokens = defaultMaxTokens
+	}
+	if req.User != "" {
+		mreq.Metadata = &metadata{UserID: req.User}
+	}
+
+	var system []string
+	for _, msg := range req.Messages {
+		var role string
+		var blocks []contentBlock
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+			system = append(system, translate.MessageText(msg))
+			continue
+		case openai.ChatMessageRoleUser:
+			role = "user"
+			for _, part := range parts(msg) {
+				block, err := partBlock(part)
+				if err != nil {
+					return mreq, err
+				}
+				blocks = append(blocks, block)
+			}
+		case openai.ChatMessageRoleAssistant:
+			role = "assistant"
+			if text := translate.MessageText(msg); text != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, contentBlock{
+					ID:    call.ID,
+					Input: input,
+					Name:  call.Function.Name,
+					Type:  "tool_use",
+				})
+			}
+		case openai.ChatMessageRoleTool:
+			role = "user"
+			blocks = append(blocks, contentBlock{
+				Content:   translate.MessageText(msg),
+				ToolUseID: msg.ToolCallID,
+				Type:      "tool_result",
+			})
+		default:
+			return mreq, fmt.Errorf("message role %s is not supported", msg.Role)
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(mreq.Messages); n > 0 && mreq.Messages[n-1].Role == role {
+			mreq.Messages[n-1].Content = append(mreq.Messages[n-1].Content, blocks...)
+		} else {
+			mreq.Messages = append(mreq.Messages, message{Content: blocks, Role: role})
+		}
+	}
+	mreq.System = strings.Join(system, "\n\n")
+
+	// the thinking blocks, and their signatures, of an assistant turn that
+	// called tools must be sent back with the results. chat completion
+	// messages cannot carry them so thinking is left off until the tool round
+	// is over.
+	if budget, ok := thinkingBudgets[req.ReasoningEffort]; ok && !inToolRound(mreq.Messages) {
+		mreq.Thinking = &thinking{BudgetTokens: budget, Type: "enabled"}
+		if mreq.MaxTokens <= budget {
+			mreq.MaxTokens += budget
+		}
+	}
+	// thinking is not compatible with changes to the temperature or top_p so
+	// they are dropped rather than having the request rejected
+	if mreq.Thinking == nil {
+		if req.Temperature != 0 {
+			mreq.Temperature = &req.Temperature
+		}
+		if req.TopP != 0 {
+			mreq.TopP = &req.TopP
+		}
+	}
+
+	for _, t := range req.Tools {
+		if t.Type != openai.ToolTypeFunction || t.Function == nil {
+			return mreq, fmt.Errorf("tool type %s is not supported", t.Type)
+		}
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		mreq.Tools = append(mreq.Tools, tool{
+			Description: t.Function.Description,
+			InputSchema: schema,
+			Name:        t.Function.Name,
+		})
+	}
+
+	var err error
+	mreq.ToolChoice, err = toToolChoice(req.ToolChoice)
+	if err != nil {
+		return mreq, err
+	}
+	return mreq, nil
+}
+
+// inToolRound returns true if the last assistant message called tools.
+func inToolRound(messages []message) bool {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "assistant" {
+			continue
+		}
+		for _, block := range messages[i].Content {
+			if block.Type == "tool_use" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// toToolChoice converts the tool choice of a chat completion request which,
+// having been unmarshaled, is either a string or a map.
+func toToolChoice(choice any) (*toolChoice, error) {
+	switch v := choice.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch v {
+		case "", "auto":
+			return &toolChoice{Type: "auto"}, nil
+		case "none":
+			return &toolChoice{Type: "none"}, nil
+		case "required":
+			return &toolChoice{Type: "any"}, nil
+		}
+	case map[string]any:
+		if function, ok := v["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok {
+				return &toolChoice{Name: name, Type: "tool"}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("tool choice %v is not supported", choice)
+}
+
+// partBlock converts a part of a user message to a content block.
+func partBlock(part openai.ChatMessagePart) (contentBlock, error) {
+	switch part.Type {
+	case openai.ChatMessagePartTypeText:
+		return contentBlock{Text: part.Text, Type: "text"}, nil
+	case openai.ChatMessagePartTypeImageURL:
+		if part.ImageURL == nil {
+			return contentBlock{}, errors.New("image part has no url")
+		}
+
+		url := part.ImageURL.URL
+		if rest, ok := strings.CutPrefix(url, "data:"); ok {
+			mediaType, data, ok := strings.Cut(rest, ";base64,")
+			if !ok {
+				return contentBlock{}, errors.New("image data url must be base64 encoded")
+			}
+			return contentBlock{
+				Source: &imageSource{Data: data, MediaType: mediaType, Type: "base64"},
+				Type:   "image",
+			}, nil
+		}
+		return contentBlock{
+			Source: &imageSource{Type: "url", URL: url},
+			Type:   "image",
+		}, nil
+	}
+	return contentBlock{}, fmt.Errorf("message part type %s is not supported", part.Type)
+}
+
+// parts returns the parts of msg, treating plain content as a single text
+// part.
+func parts(msg openai.ChatCompletionMessage) []openai.ChatMessagePart {
+	if len(msg.MultiContent) > 0 {
+		return msg.MultiContent
+	}
+	if msg.Content == "" {
+		return nil
+	}
+	return []openai.ChatMessagePart{{Text: msg.Content, Type: openai.ChatMessagePartTypeText}}
+}
+
+// finishReason converts the stop reason of a message.
+func finishReason(stopReason string) openai.FinishReason {
+	switch stopReason {
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "refusal":
+		return openai.FinishReasonContentFilter
+	case "":
+		return ""
+	}
+	return openai.FinishReasonStop
+}
+
+// fromMessagesResponse converts a messages response to a chat completion
+// response. Thinking is returned as reasoning content.
+func fromMessagesResponse(resp messagesResponse) openai.ChatCompletionResponse {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var text []string
+	var thoughts []string
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "thinking":
+			thoughts = append(thoughts, block.Thinking)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				Function: openai.FunctionCall{Arguments: string(block.Input), Name: block.Name},
+				ID:       block.ID,
+				Index:    ptr(len(msg.ToolCalls)),
+				Type:     openai.ToolTypeFunction,
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "")
+	msg.ReasoningContent = strings.Join(thoughts, "\n\n")
+
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			FinishReason: finishReason(resp.StopReason),
+			Message:      msg,
+		}},
+		Created: time.Now().Unix(),
+		ID:      resp.ID,
+		Model:   resp.Model,
+		Object:  "chat.completion",
+		Usage:   resp.Usage.openai(),
+	}
+}
+
+// openai converts the usage, the input tokens of the chat completion include
+// those read from and written to the cache.
+func (u usage) openai() openai.Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return openai.Usage{
+		CompletionTokens: u.OutputTokens,
+		PromptTokens:     prompt,
+		PromptTokensDetails: &openai.PromptTokensDetails{
+			CachedTokens: u.CacheReadInputTokens,
+		},
+		TotalTokens: prompt + u.OutputTokens,
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,173 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxEventSize is the largest server sent event line that can be read.
+const maxEventSize = 16 << 20
+
+type streamDelta struct {
+	PartialJSON string `json:"partial_json"`
+	StopReason  string `json:"stop_reason"`
+	Text        string `json:"text"`
+	Thinking    string `json:"thinking"`
+	Type        string `json:"type"`
+}
+
+type streamEvent struct {
+	ContentBlock *contentBlock     `json:"content_block"`
+	Delta        *streamDelta      `json:"delta"`
+	Error        *errorDetail      `json:"error"`
+	Index        int               `json:"index"`
+	Message      *messagesResponse `json:"message"`
+	Type         string            `json:"type"`
+	Usage        *usage            `json:"usage"`
+}
+
+// streamTranslator converts the events of a messages stream to chat
+// completion chunks.
+type streamTranslator struct {
+	includeUsage bool
+	// toolIndexes maps the index of a tool_use content block to the index of
+	// the tool call
+	toolIndexes map[int]int
+	usage       usage
+	w           *translate.StreamWriter
+}
+
+// translateStream reads the server sent events of a messages stream from r
+// and writes them to w as the server sent events of a chat completion stream.
+func translateStream(r io.Reader, w io.Writer, includeUsage bool) error {
+	t := streamTranslator{
+		includeUsage: includeUsage,
+		toolIndexes:  map[int]int{},
+		w:            &translate.StreamWriter{Created: time.Now().Unix(), W: w},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxEventSize)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event streamEvent
+		err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event)
+		if err != nil {
+			return fmt.Errorf("unmarshal event: %w", err)
+		}
+
+		done, err := t.translate(event)
+		if err != nil || done {
+			return err
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return errors.New("stream ended before message_stop")
+}
+
+// translate writes the chunks for event and returns true once the stream is
+// done.
+func (t *streamTranslator) translate(event streamEvent) (bool, error) {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			t.w.ID = event.Message.ID
+			t.w.Model = event.Message.Model
+			t.usage = event.Message.Usage
+		}
+		return false, t.writeDelta(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	case "content_block_start":
+		block := event.ContentBlock
+		if block == nil {
+			return false, nil
+		}
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				return false, t.writeDelta(openai.ChatCompletionStreamChoiceDelta{Content: block.Text}, "")
+			}
+		case "tool_use":
+			index := len(t.toolIndexes)
+			t.toolIndexes[event.Index] = index
+			return false, t.writeDelta(
+				openai.ChatCompletionStreamChoiceDelta{
+					ToolCalls: []openai.ToolCall{{
+						Function: openai.FunctionCall{Name: block.Name},
+						ID:       block.ID,
+						Index:    &index,
+						Type:     openai.ToolTypeFunction,
+					}},
+				},
+				"")
+		}
+	case "content_block_delta":
+		delta := event.Delta
+		if delta == nil {
+			return false, nil
+		}
+		switch delta.Type {
+		case "text_delta":
+			return false, t.writeDelta(openai.ChatCompletionStreamChoiceDelta{Content: delta.Text}, "")
+		case "thinking_delta":
+			return false, t.writeDelta(openai.ChatCompletionStreamChoiceDelta{ReasoningContent: delta.Thinking}, "")
+		case "input_json_delta":
+			index := t.toolIndexes[event.Index]
+			return false, t.writeDelta(
+				openai.ChatCompletionStreamChoiceDelta{
+					ToolCalls: []openai.ToolCall{{
+						Function: openai.FunctionCall{Arguments: delta.PartialJSON},
+						Index:    &index,
+					}},
+				},
+				"")
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			// the usage of a message delta is cumulative
+			t.usage.OutputTokens = event.Usage.OutputTokens
+		}
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			return false, t.writeDelta(openai.ChatCompletionStreamChoiceDelta{}, finishReason(event.Delta.StopReason))
+		}
+	case "message_stop":
+		if t.includeUsage {
+			err := t.w.WriteUsage(t.usage.openai())
+			if err != nil {
+				return true, err
+			}
+		}
+		return true, t.w.Done()
+	case "error":
+		detail := errorDetail{Message: "unknown error", Type: "error"}
+		if event.Error != nil {
+			detail = *event.Error
+		}
+		return true, t.w.Error(detail.Message, detail.Type)
+	}
+	return false, nil
+}
+
+func (t *streamTranslator) writeDelta(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) error {
+	return t.w.Write(openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        delta,
+			FinishReason: finish,
+		}},
+	})
+}
@@ -0,0 +1,153 @@
+// Package anthropic lets an openai client talk to the anthropic messages api
+// by translating requests and responses in its transport.
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	DefaultBaseURL = "https://api.anthropic.com/v1"
+	// DefaultVersion is the anthropic-version sent if the endpoint does not
+	// configure an api version.
+	DefaultVersion = openai.AnthropicAPIVersion
+)
+
+// Transport translates the chat completion and model list requests of an
+// openai client to the anthropic messages api and the responses back.
+type Transport struct {
+	Wrapped http.RoundTripper
+}
+
+type modelsResponse struct {
+	Data []struct {
+		CreatedAt time.Time `json:"created_at"`
+		ID        string    `json:"id"`
+	} `json:"data"`
+}
+
+// NewTransport returns a transport that sends translated requests using
+// wrapped.
+func NewTransport(wrapped http.RoundTripper) *Transport {
+	return &Transport{Wrapped: wrapped}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		return t.chatCompletion(r)
+	case strings.HasSuffix(r.URL.Path, "/models") && r.Method == http.MethodGet:
+		return t.models(r)
+	}
+	return nil, fmt.Errorf("anthropic: %s is not supported", r.URL.Path)
+}
+
+func (t *Transport) chatCompletion(r *http.Request) (*http.Response, error) {
+	req, _, err := translate.DecodeChatRequest(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: %w", err)
+	}
+
+	mreq, err := toMessagesRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: %w", err)
+	}
+
+	out := r.Clone(r.Context())
+	out.URL.Path = strings.TrimSuffix(out.URL.Path, "/chat/completions") + "/messages"
+	err = translate.SetBody(out, mreq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: %w", err)
+	}
+	setHeaders(out)
+
+	resp, err := t.Wrapped.RoundTrip(out)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return translateError(resp)
+	}
+
+	if mreq.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		return translate.Stream(resp, func(r io.Reader, w io.Writer) error {
+			return translateStream(r, w, includeUsage)
+		}), nil
+	}
+
+	var mresp messagesResponse
+	err = json.NewDecoder(resp.Body).Decode(&mresp)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("anthropic decode response: %w", err)
+	}
+
+	return translate.ReplaceBody(resp, fromMessagesResponse(mresp))
+}
+
+func (t *Transport) models(r *http.Request) (*http.Response, error) {
+	out := r.Clone(r.Context())
+	setHeaders(out)
+
+	resp, err := t.Wrapped.RoundTrip(out)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return translateError(resp)
+	}
+
+	var models modelsResponse
+	err = json.NewDecoder(resp.Body).Decode(&models)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("anthropic decode models: %w", err)
+	}
+
+	list := openai.ModelsList{Models: make([]openai.Model, 0, len(models.Data))}
+	for _, model := range models.Data {
+		list.Models = append(list.Models, openai.Model{
+			CreatedAt: model.CreatedAt.Unix(),
+			ID:        model.ID,
+			Object:    "model",
+			OwnedBy:   "anthropic",
+		})
+	}
+	return translate.ReplaceBody(resp, list)
+}
+
+func setHeaders(r *http.Request) {
+	if r.Header.Get("anthropic-version") == "" {
+		r.Header.Set("anthropic-version", DefaultVersion)
+	}
+	r.Header.Set("Content-Type", "application/json")
+}
+
+// translateError converts an error response to the form of an openai error so
+// the client reports its message.
+func translateError(resp *http.Response) (*http.Response, error) {
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("anthropic read error: %w", err)
+	}
+
+	var errResp errorResponse
+	err = json.Unmarshal(data, &errResp)
+	if err != nil || errResp.Error.Message == "" {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+	return translate.ReplaceBody(resp, errResp)
+}
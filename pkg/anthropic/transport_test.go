@@ -0,0 +1,287 @@
+package anthropic_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer returns a stand in for the messages api that records the request
+// it receives and responds with status and body.
+func newServer(t *testing.T, status int, body string, received *map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/messages", r.URL.Path)
+		require.Equal(t, "secret", r.Header.Get("x-api-key"))
+		require.Equal(t, "2023-06-01", r.Header.Get("anthropic-version"))
+		require.Empty(t, r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(received))
+
+		if (*received)["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newClient(server *httptest.Server) *openai.Client {
+	endpoint := config.EndpointConfig{
+		APIType:   openai.APITypeAnthropic,
+		AuthToken: "secret",
+		BaseURL:   server.URL + "/v1",
+	}
+	return endpoint.NewClient()
+}
+
+func TestChatCompletion(t *testing.T) {
+	var received map[string]any
+	server := newServer(t, http.StatusOK, `{
+  "id": "msg_1",
+  "type": "message",
+  "role": "assistant",
+  "model": "claude-test",
+  "content": [
+    {"type": "thinking", "thinking": "the user wants the weather", "signature": "sig"},
+    {"type": "text", "text": "let me check"},
+    {"type": "tool_use", "id": "toolu_2", "name": "weather", "input": {"city": "paris"}}
+  ],
+  "stop_reason": "tool_use",
+  "usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 7}
+}`, &received)
+
+	resp, err := newClient(server).CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: "claude-test",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+				{Role: openai.ChatMessageRoleUser, Content: "weather in london?"},
+				{
+					Role: openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{{
+						ID:       "toolu_1",
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: "weather", Arguments: `{"city":"london"}`},
+					}},
+				},
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "toolu_1", Content: "rain"},
+				{
+					Role: openai.ChatMessageRoleUser,
+					MultiContent: []openai.ChatMessagePart{
+						{Type: openai.ChatMessagePartTypeText, Text: "and paris?"},
+						{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,aGk="}},
+					},
+				},
+			},
+			Tools: []openai.Tool{{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        "weather",
+					Description: "get the weather",
+					Parameters:  map[string]any{"type": "object"},
+				},
+			}},
+			ToolChoice: "required",
+		})
+	require.NoError(t, err)
+
+	expected := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "max_tokens": 4096,
+  "model": "claude-test",
+  "system": "be brief",
+  "messages": [
+    {"role": "user", "content": [{"type": "text", "text": "weather in london?"}]},
+    {"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "london"}}]},
+    {"role": "user", "content": [
+      {"type": "tool_result", "tool_use_id": "toolu_1", "content": "rain"},
+      {"type": "text", "text": "and paris?"},
+      {"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "aGk="}}
+    ]}
+  ],
+  "tools": [{"name": "weather", "description": "get the weather", "input_schema": {"type": "object"}}],
+  "tool_choice": {"type": "any"}
+}`), &expected))
+	require.Equal(t, expected, received)
+
+	require.Equal(t, "msg_1", resp.ID)
+	require.Len(t, resp.Choices, 1)
+	choice := resp.Choices[0]
+	require.Equal(t, openai.FinishReasonToolCalls, choice.FinishReason)
+	require.Equal(t, "let me check", choice.Message.Content)
+	require.Equal(t, "the user wants the weather", choice.Message.ReasoningContent)
+	require.Len(t, choice.Message.ToolCalls, 1)
+	require.Equal(t, "toolu_2", choice.Message.ToolCalls[0].ID)
+	require.Equal(t, "weather", choice.Message.ToolCalls[0].Function.Name)
+	require.JSONEq(t, `{"city":"paris"}`, choice.Message.ToolCalls[0].Function.Arguments)
+	require.Equal(t, 15, resp.Usage.PromptTokens)
+	require.Equal(t, 7, resp.Usage.CompletionTokens)
+	require.Equal(t, 22, resp.Usage.TotalTokens)
+}
+
+func TestChatCompletionThinking(t *testing.T) {
+	response := `{
+  "id": "msg_1",
+  "type": "message",
+  "role": "assistant",
+  "model": "claude-test",
+  "content": [{"type": "text", "text": "done"}],
+  "stop_reason": "end_turn",
+  "usage": {"input_tokens": 10, "output_tokens": 7}
+}`
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "weather in london?"}
+	call := openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID:       "toolu_1",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "weather", Arguments: `{"city":"london"}`},
+		}},
+	}
+	result := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: "toolu_1", Content: "rain"}
+	answer := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "it is raining"}
+
+	tester := func(t *testing.T, messages []openai.ChatCompletionMessage, expectThinking bool) {
+		var received map[string]any
+		server := newServer(t, http.StatusOK, response, &received)
+
+		_, err := newClient(server).CreateChatCompletion(
+			context.Background(),
+			openai.ChatCompletionRequest{
+				Model:           "claude-test",
+				Messages:        messages,
+				ReasoningEffort: "low",
+				Temperature:     0.5,
+				TopP:            0.9,
+			})
+		require.NoError(t, err)
+
+		if expectThinking {
+			require.Equal(t, map[string]any{"type": "enabled", "budget_tokens": float64(1024)}, received["thinking"])
+			require.NotContains(t, received, "temperature")
+			require.NotContains(t, received, "top_p")
+		} else {
+			require.NotContains(t, received, "thinking")
+			require.InDelta(t, 0.5, received["temperature"], 0.001)
+			require.InDelta(t, 0.9, received["top_p"], 0.001)
+		}
+	}
+
+	t.Run("question", func(t *testing.T) {
+		tester(t, []openai.ChatCompletionMessage{user}, true)
+	})
+	t.Run("tool round", func(t *testing.T) {
+		tester(t, []openai.ChatCompletionMessage{user, call, result}, false)
+	})
+	t.Run("after tool round", func(t *testing.T) {
+		tester(t, []openai.ChatCompletionMessage{user, call, result, answer, user}, true)
+	})
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-test","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"paris\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+		`{"type":"message_stop"}`,
+	}
+	var body string
+	for _, event := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(event), &typed))
+		body += fmt.Sprintf("event: %s\ndata: %s\n\n", typed.Type, event)
+	}
+
+	var received map[string]any
+	server := newServer(t, http.StatusOK, body, &received)
+
+	stream, err := newClient(server).CreateChatCompletionStream(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:         "claude-test",
+			MaxTokens:     100,
+			Messages:      []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			Stream:        true,
+			StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		})
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+	require.Equal(t, true, received["stream"])
+	require.InDelta(t, 100, received["max_tokens"], 0)
+
+	var content string
+	var arguments string
+	var finish openai.FinishReason
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, "msg_1", chunk.ID)
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+			for _, call := range choice.Delta.ToolCalls {
+				require.Equal(t, 0, *call.Index)
+				arguments += call.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				finish = choice.FinishReason
+			}
+		}
+	}
+
+	require.Equal(t, "hello world", content)
+	require.Equal(t, `{"city":"paris"}`, arguments)
+	require.Equal(t, openai.FinishReasonToolCalls, finish)
+	require.NotNil(t, usage)
+	require.Equal(t, 10, usage.PromptTokens)
+	require.Equal(t, 12, usage.CompletionTokens)
+}
+
+func TestChatCompletionError(t *testing.T) {
+	var received map[string]any
+	server := newServer(
+		t,
+		http.StatusBadRequest,
+		`{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: too large"}}`,
+		&received)
+
+	_, err := newClient(server).CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:    "claude-test",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+		})
+	var apiErr *openai.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusBadRequest, apiErr.HTTPStatusCode)
+	require.Equal(t, "max_tokens: too large", apiErr.Message)
+}
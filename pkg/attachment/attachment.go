@@ -0,0 +1,400 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	binaryHeader = "########## base64 encoded attachments ##########\n"
+	// sniffLen is how much content is checked for NUL bytes, the same as git.
+	sniffLen = 8000
+)
+
+// imageMediaTypes are the image formats accepted by vision models.
+var imageMediaTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// File is a single attached file.
+type File struct {
+	Content []byte
+	// Lang is the language used to label the fenced block of a text file, if
+	// empty it is the extension of Name.
+	Lang      string
+	MediaType string
+	// Name is the name the file is presented to the model as.
+	Name string
+}
+
+type LoadOption func(*LoadOptions)
+
+type LoadOptions struct {
+	binary   bool
+	excludes []string
+}
+
+// IsText returns true if the content of the file is UTF-8 text without any
+// NUL bytes.
+func (f File) IsText() bool {
+	sniff := f.Content[:min(len(f.Content), sniffLen)]
+	return !bytes.ContainsRune(sniff, 0) && utf8.Valid(f.Content)
+}
+
+// IsImage returns true if the file is an image that can be sent to a vision
+// model as an image_url part.
+func (f File) IsImage() bool {
+	return imageMediaTypes[f.MediaType]
+}
+
+// AppendParts appends parts to the content of msg. If all of the parts are
+// text and msg is not already multi-part, they are appended to the plain
+// content so that servers without multi-part support still work. Otherwise
+// msg is converted to multi-part with its existing content as the first part.
+func AppendParts(msg *openai.ChatCompletionMessage, parts []openai.ChatMessagePart) {
+	if len(parts) == 0 {
+		return
+	}
+
+	if len(msg.MultiContent) == 0 {
+		allText := true
+		for _, part := range parts {
+			if part.Type != openai.ChatMessagePartTypeText {
+				allText = false
+				break
+			}
+		}
+
+		if allText {
+			for _, part := range parts {
+				msg.Content += "\n\n" + part.Text
+			}
+			return
+		}
+
+		if msg.Content != "" {
+			msg.MultiContent = []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: msg.Content},
+			}
+			msg.Content = ""
+		}
+	}
+
+	msg.MultiContent = append(msg.MultiContent, parts...)
+}
+
+// ImagePart returns an image_url part for v which is either a http(s) or data
+// URL that is passed thru as is, or the path of an image file that is encoded
+// as a data URL.
+func ImagePart(v string, detail openai.ImageURLDetail) (openai.ChatMessagePart, error) {
+	if isURL(v) {
+		return imageURLPart(v, detail), nil
+	}
+
+	file, err := readFile(filepath.Base(v), v)
+	if err != nil {
+		return openai.ChatMessagePart{}, fmt.Errorf("image: %w", err)
+	}
+	if !file.IsImage() {
+		return openai.ChatMessagePart{}, fmt.Errorf("image %s: unsupported type %s", v, file.MediaType)
+	}
+
+	return imageURLPart(dataURL(file), detail), nil
+}
+
+// Load reads the attachments in the form [alias:]path where alias is optional
+// and if not supplied the basename of path will be used. If path is a
+// directory, it is walked recursively and every file is included using its
+// path as the name. If path is a glob pattern (** matches any number of
+// directories), every matching file is included. Files found by walking or
+// globbing are skipped if ignored by a .gitignore (including those of parent
+// directories up to the repository root), matched by an exclude, or binary
+// (unless WithBinary is used) other than images. Files named explicitly are always
+// included, and archives, PDFs, HTML and notebooks among them are converted
+// to text.
+func Load(attachments []string, opts ...LoadOption) ([]File, error) {
+	loadOpts := LoadOptions{}
+	for _, opt := range opts {
+		opt(&loadOpts)
+	}
+
+	excludes := make([]*regexp.Regexp, 0, len(loadOpts.excludes))
+	for _, exclude := range loadOpts.excludes {
+		if !strings.Contains(exclude, "/") {
+			exclude = "**/" + exclude
+		}
+		re, err := compileGlob(exclude)
+		if err != nil {
+			return nil, fmt.Errorf("exclude: %w", err)
+		}
+		excludes = append(excludes, re)
+	}
+
+	var files []File
+	for _, attachment := range attachments {
+		name, path, ok := strings.Cut(attachment, ":")
+		if !ok {
+			path = name
+			name = filepath.Base(path)
+		}
+
+		if hasMeta(path) {
+			if ok {
+				return nil, fmt.Errorf("attachment %s: alias not supported with a glob", attachment)
+			}
+
+			re, err := compileGlob(filepath.ToSlash(filepath.Clean(path)))
+			if err != nil {
+				return nil, fmt.Errorf("attachment: %w", err)
+			}
+
+			found, err := walk(globRoot(filepath.ToSlash(path)), re, excludes, loadOpts.binary)
+			if err != nil {
+				return nil, fmt.Errorf("attachment glob: %w", err)
+			}
+			files = append(files, found...)
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("stat attachment: %w", err)
+		}
+
+		if !info.IsDir() {
+			file, err := readFile(name, path)
+			if err != nil {
+				return nil, err
+			}
+			extracted, err := extract(file, loadOpts.binary)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, extracted...)
+			continue
+		}
+
+		found, err := walk(filepath.ToSlash(path), nil, excludes, loadOpts.binary)
+		if err != nil {
+			return nil, fmt.Errorf("attachment walk: %w", err)
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// Parts returns the message parts for files. Text files are inlined in
+// fenced blocks labeled with their name, images become image_url parts with
+// data URLs, and all other files are base64 encoded. All of the text is
+// combined into a single text part ahead of the images.
+func Parts(files []File, detail openai.ImageURLDetail) []openai.ChatMessagePart {
+	var images []openai.ChatMessagePart
+	var text []string
+	var binary strings.Builder
+	for _, file := range files {
+		switch {
+		case file.IsImage():
+			images = append(images, imageURLPart(dataURL(file), detail))
+		case file.IsText():
+			text = append(text, fenced(file))
+		default:
+			if binary.Len() == 0 {
+				binary.WriteString(binaryHeader)
+			}
+			fmt.Fprintf(&binary, "%s: %s\n", file.Name, base64.StdEncoding.EncodeToString(file.Content))
+		}
+	}
+
+	if binary.Len() > 0 {
+		text = append(text, binary.String())
+	}
+	if len(text) == 0 {
+		return images
+	}
+	return append(
+		[]openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: strings.Join(text, "\n\n")}},
+		images...)
+}
+
+// WithBinary includes binary files found by walking a directory or globbing
+// which are skipped by default.
+func WithBinary() LoadOption {
+	return func(o *LoadOptions) {
+		o.binary = true
+	}
+}
+
+// WithExclude skips files and directories found by walking a directory or
+// globbing that match any of the glob patterns. Patterns without a slash are
+// matched against the name at any depth.
+func WithExclude(patterns ...string) LoadOption {
+	return func(o *LoadOptions) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+func dataURL(file File) string {
+	return fmt.Sprintf(
+		"data:%s;base64,%s",
+		file.MediaType,
+		base64.StdEncoding.EncodeToString(file.Content))
+}
+
+// fence returns content in a fenced block labeled with lang. The fence is
+// longer than any run of backticks in the content so it cannot be closed
+// early.
+func fence(lang string, content string) string {
+	longest := 0
+	run := 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	backticks := strings.Repeat("`", max(3, longest+1))
+	return fmt.Sprintf("%s%s\n%s\n%s", backticks, lang, strings.TrimSuffix(content, "\n"), backticks)
+}
+
+// fenced returns the content of file in a fenced block labeled with its name
+// and language.
+func fenced(file File) string {
+	lang := file.Lang
+	if lang == "" {
+		lang = strings.TrimPrefix(filepath.Ext(file.Name), ".")
+	}
+	return file.Name + ":\n" + fence(lang, string(file.Content))
+}
+
+func imageURLPart(url string, detail openai.ImageURLDetail) openai.ChatMessagePart {
+	return openai.ChatMessagePart{
+		Type: openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{
+			Detail: detail,
+			URL:    url,
+		},
+	}
+}
+
+func isURL(v string) bool {
+	return strings.HasPrefix(v, "data:") ||
+		strings.HasPrefix(v, "http://") ||
+		strings.HasPrefix(v, "https://")
+}
+
+// walk returns the files below root that match (all files if match is nil)
+// and are not excluded, ignored, or binary. The .gitignore files of the
+// directories above root, up to the root of its repository, apply as well.
+func walk(root string, match *regexp.Regexp, excludes []*regexp.Regexp, binary bool) ([]File, error) {
+	root = path.Clean(root)
+	absRoot, err := filepath.Abs(filepath.FromSlash(root))
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", root, err)
+	}
+	absRoot = filepath.ToSlash(absRoot)
+	parentRules, err := loadParentIgnoreFiles(absRoot)
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", root, err)
+	}
+
+	var files []File
+	// rules are keyed by the walked path of their directory, they are
+	// matched against absolute paths so that those of parents apply
+	rules := map[string]ignoreRules{}
+	err = filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		p = filepath.ToSlash(p)
+		rel := p
+		if root != "." {
+			rel = strings.TrimPrefix(p, root+"/")
+		}
+		abs := absRoot
+		if p != root {
+			abs = path.Join(absRoot, rel)
+		}
+
+		if p != root {
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			ignored := rules[path.Dir(p)].Ignored(abs, d.IsDir())
+			for _, exclude := range excludes {
+				ignored = ignored || exclude.MatchString(rel) || exclude.MatchString(p)
+			}
+			if ignored {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.IsDir() {
+			parent := rules[path.Dir(p)]
+			if p == root {
+				parent = parentRules
+			}
+			dirRules, err := parent.loadIgnoreFile(abs)
+			if err != nil {
+				return err
+			}
+			// copy so sibling directories do not share rules
+			rules[p] = append(ignoreRules(nil), dirRules...)
+			return nil
+		}
+
+		if match != nil && !match.MatchString(p) {
+			return nil
+		}
+
+		file, err := readFile(p, filepath.FromSlash(p))
+		if err != nil {
+			return err
+		}
+		// only files named explicitly are extracted, a walk attaches the
+		// files it finds, such as html sources, as they are
+		if binary || file.IsText() || file.IsImage() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", root, err)
+	}
+	return files, nil
+}
+
+func readFile(name string, path string) (File, error) {
+	//nolint: gosec // the intent is to include a file from a user supplied location
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, fmt.Errorf("read attachment: %w", err)
+	}
+
+	mediaType, _, _ := strings.Cut(http.DetectContentType(content), ";")
+	return File{
+		Content:   content,
+		MediaType: mediaType,
+		Name:      name,
+	}, nil
+}
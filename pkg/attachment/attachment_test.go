@@ -0,0 +1,190 @@
+package attachment_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/attachment"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+// png is the signature of a png image which is all that is needed to detect
+// the media type.
+var png = []byte("\x89PNG\r\n\x1a\n")
+
+func TestAppendParts(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cat.png"), png, 0600))
+
+	tester := func(
+		t *testing.T,
+		attachments []string,
+		expected openai.ChatCompletionMessage,
+	) {
+		files, err := attachment.Load(attachments)
+		require.NoError(t, err)
+
+		msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "look"}
+		attachment.AppendParts(&msg, attachment.Parts(files, openai.ImageURLDetailLow))
+		require.Equal(t, expected, msg)
+
+		// multi-part messages must survive persistence in a conversation
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		var loaded openai.ChatCompletionMessage
+		require.NoError(t, json.Unmarshal(data, &loaded))
+		require.Equal(t, expected, loaded)
+	}
+
+	t.Run("text only", func(t *testing.T) {
+		tester(
+			t,
+			[]string{"n.txt:" + filepath.Join(dir, "notes.txt")},
+			openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleUser,
+				Content: "look\n\n" +
+					"n.txt:\n```txt\nhello\n```",
+			})
+	})
+
+	t.Run("image", func(t *testing.T) {
+		tester(
+			t,
+			[]string{filepath.Join(dir, "cat.png")},
+			openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{
+					{Type: openai.ChatMessagePartTypeText, Text: "look"},
+					{
+						Type: openai.ChatMessagePartTypeImageURL,
+						ImageURL: &openai.ChatMessageImageURL{
+							Detail: openai.ImageURLDetailLow,
+							URL:    "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+						},
+					},
+				},
+			})
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+	write(".git/HEAD", "ref: refs/heads/main")
+	write(".gitignore", "*.log\nbuild/\n")
+	write("main.go", "package main")
+	write("debug.log", "noise")
+	write("build/out.go", "package build")
+	write("data.bin", "\x00\x01\x02")
+	write("pkg/.gitignore", "!keep.log\n")
+	write("pkg/cat.png", string(png))
+	write("pkg/debug.log", "noise")
+	write("pkg/keep.log", "kept")
+	write("pkg/util.go", "package pkg")
+	write("pkg/util_test.go", "package pkg_test")
+	write("pkg/sub/deep.go", "package sub")
+
+	tester := func(t *testing.T, attachments []string, opts []attachment.LoadOption, expected []string) {
+		files, err := attachment.Load(attachments, opts...)
+		require.NoError(t, err)
+
+		names := make([]string, 0, len(files))
+		for _, file := range files {
+			rel, err := filepath.Rel(dir, file.Name)
+			require.NoError(t, err)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		require.Equal(t, expected, names)
+	}
+
+	t.Run("walk", func(t *testing.T) {
+		tester(
+			t,
+			[]string{dir},
+			nil,
+			[]string{
+				".gitignore",
+				"main.go",
+				"pkg/.gitignore",
+				"pkg/cat.png",
+				"pkg/keep.log",
+				"pkg/sub/deep.go",
+				"pkg/util.go",
+				"pkg/util_test.go",
+			})
+	})
+
+	t.Run("subdirectory", func(t *testing.T) {
+		// the .gitignore of the repository root still applies
+		tester(
+			t,
+			[]string{filepath.Join(dir, "pkg")},
+			nil,
+			[]string{"pkg/.gitignore", "pkg/cat.png", "pkg/keep.log", "pkg/sub/deep.go", "pkg/util.go", "pkg/util_test.go"})
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		tester(
+			t,
+			[]string{dir},
+			[]attachment.LoadOption{attachment.WithExclude(".gitignore", "*_test.go", "pkg/sub")},
+			[]string{"main.go", "pkg/cat.png", "pkg/keep.log", "pkg/util.go"})
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		tester(
+			t,
+			[]string{filepath.Join(dir, "*")},
+			[]attachment.LoadOption{attachment.WithBinary()},
+			[]string{".gitignore", "data.bin", "main.go"})
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		tester(
+			t,
+			[]string{filepath.Join(dir, "**", "*.go")},
+			nil,
+			[]string{"main.go", "pkg/sub/deep.go", "pkg/util.go", "pkg/util_test.go"})
+	})
+}
+
+func TestParts(t *testing.T) {
+	parts := attachment.Parts(
+		[]attachment.File{
+			{Name: "a.md", Content: []byte("~~~\n```go\nx\n```\n")},
+			{Name: "b.bin", Content: []byte{0, 1}},
+		},
+		"")
+	require.Equal(
+		t,
+		[]openai.ChatMessagePart{
+			{
+				Type: openai.ChatMessagePartTypeText,
+				Text: "a.md:\n````md\n~~~\n```go\nx\n```\n````\n\n" +
+					"########## base64 encoded attachments ##########\n" +
+					"b.bin: " + base64.StdEncoding.EncodeToString([]byte{0, 1}) + "\n",
+			},
+		},
+		parts)
+}
+
+func TestImagePart(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600))
+
+	part, err := attachment.ImagePart("https://example.com/cat.png", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/cat.png", part.ImageURL.URL)
+
+	_, err = attachment.ImagePart(filepath.Join(dir, "notes.txt"), "")
+	require.ErrorContains(t, err, "unsupported type text/plain")
+}
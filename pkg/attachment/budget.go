@@ -0,0 +1,174 @@
+package attachment
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/pastdev/askai/pkg/tokenizer"
+)
+
+const (
+	ActionSkipped   Action = "skipped"
+	ActionTruncated Action = "truncated"
+
+	// minTruncatedTokens is the fewest tokens of a file worth keeping,
+	// anything less is skipped instead of truncated.
+	minTruncatedTokens = 64
+	truncatedMarker    = "\n[truncated]"
+)
+
+// Action is what a budget did to a file to fit.
+type Action string
+
+// Usage is the number of tokens a file uses once formatted as a message part.
+type Usage struct {
+	Action Action
+	// Image is true for images, whose tokens depend on their dimensions and
+	// the model so they are not counted.
+	Image bool
+	Name  string
+	// Original is the number of tokens before the budget was applied.
+	Original int
+	Tokens   int
+}
+
+// Report is the usage of each file.
+type Report []Usage
+
+// Budget counts the tokens of each file and, if maxTokens is greater than 0
+// and the total exceeds it, truncates or skips the largest files until it
+// fits. Files too small to be worth truncating are skipped. The files that
+// remain, possibly truncated, are returned with a report of every file.
+func Budget(
+	files []File,
+	tkzr tokenizer.Tokenizer,
+	maxTokens int,
+) ([]File, Report) {
+	report := make(Report, len(files))
+	total := 0
+	for i, file := range files {
+		tokens := countTokens(file, tkzr)
+		report[i] = Usage{
+			Image:    file.IsImage(),
+			Name:     file.Name,
+			Original: tokens,
+			Tokens:   tokens,
+		}
+		total += tokens
+	}
+
+	if maxTokens <= 0 || total <= maxTokens {
+		return files, report
+	}
+
+	largest := make([]int, len(files))
+	for i := range largest {
+		largest[i] = i
+	}
+	slices.SortStableFunc(largest, func(a int, b int) int {
+		return report[b].Tokens - report[a].Tokens
+	})
+
+	budgeted := slices.Clone(files)
+	for _, i := range largest {
+		excess := total - maxTokens
+		if excess <= 0 {
+			break
+		}
+
+		usage := &report[i]
+		keep := usage.Tokens - excess
+		if budgeted[i].IsText() && keep >= minTruncatedTokens {
+			budgeted[i] = truncate(budgeted[i], tkzr, keep)
+			usage.Action = ActionTruncated
+			usage.Tokens = countTokens(budgeted[i], tkzr)
+		} else {
+			usage.Action = ActionSkipped
+			usage.Tokens = 0
+		}
+		total -= usage.Original - usage.Tokens
+	}
+
+	remaining := make([]File, 0, len(budgeted))
+	for i, file := range budgeted {
+		if report[i].Action != ActionSkipped {
+			remaining = append(remaining, file)
+		}
+	}
+	return remaining, report
+}
+
+// Total returns the number of tokens used by all of the files.
+func (r Report) Total() int {
+	total := 0
+	for _, usage := range r {
+		total += usage.Tokens
+	}
+	return total
+}
+
+// Write writes a table of the tokens used by each file followed by the total.
+func (r Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(tw, "tokens\tattachment\tnote")
+	if err != nil {
+		return fmt.Errorf("report header: %w", err)
+	}
+
+	for _, usage := range r {
+		var note string
+		switch {
+		case usage.Image:
+			note = "image (not counted)"
+		case usage.Action != "":
+			note = fmt.Sprintf("%s from %d", usage.Action, usage.Original)
+		}
+
+		_, err := fmt.Fprintf(tw, "%d\t%s\t%s\n", usage.Tokens, usage.Name, note)
+		if err != nil {
+			return fmt.Errorf("report row: %w", err)
+		}
+	}
+
+	_, err = fmt.Fprintf(tw, "%d\ttotal\t\n", r.Total())
+	if err != nil {
+		return fmt.Errorf("report total: %w", err)
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("report flush: %w", err)
+	}
+	return nil
+}
+
+// countTokens returns the number of tokens file uses in the text that Parts
+// would generate for it.
+func countTokens(file File, tkzr tokenizer.Tokenizer) int {
+	var text string
+	switch {
+	case file.IsImage():
+		return 0
+	case file.IsText():
+		text = fenced(file)
+	default:
+		text = fmt.Sprintf("%s: %s\n", file.Name, base64.StdEncoding.EncodeToString(file.Content))
+	}
+	return len(tkzr.Encode(text, nil, nil))
+}
+
+// truncate returns file with its content cut down so the file uses about
+// keep tokens once formatted.
+func truncate(file File, tkzr tokenizer.Tokenizer, keep int) File {
+	overhead := countTokens(File{Name: file.Name}, tkzr) +
+		len(tkzr.Encode(truncatedMarker, nil, nil))
+	tokens := tkzr.Encode(string(file.Content), nil, nil)
+	keep = max(0, min(len(tokens), keep-overhead))
+
+	file.Content = []byte(tkzr.Decode(tokens[:keep]) + truncatedMarker)
+	return file
+}
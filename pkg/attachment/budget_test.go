@@ -0,0 +1,81 @@
+package attachment_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/attachment"
+	"github.com/pastdev/askai/pkg/tokenizer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	files := []attachment.File{
+		{Name: "small.txt", Content: []byte("tiny")},
+		{Name: "large.txt", Content: []byte(strings.Repeat("abcd", 1000))},
+		{Name: "medium.txt", Content: []byte(strings.Repeat("abcd", 200))},
+		{Name: "cat.png", Content: png, MediaType: "image/png"},
+	}
+
+	tester := func(
+		t *testing.T,
+		maxTokens int,
+		expectedNames []string,
+		expectedActions []attachment.Action,
+	) attachment.Report {
+		budgeted, report := attachment.Budget(files, tokenizer.ApproximateTokenizer{}, maxTokens)
+
+		names := make([]string, 0, len(budgeted))
+		for _, file := range budgeted {
+			names = append(names, file.Name)
+		}
+		require.Equal(t, expectedNames, names)
+
+		actions := make([]attachment.Action, 0, len(report))
+		for _, usage := range report {
+			actions = append(actions, usage.Action)
+		}
+		require.Equal(t, expectedActions, actions)
+		if maxTokens > 0 {
+			require.LessOrEqual(t, report.Total(), maxTokens)
+		}
+		return report
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		report := tester(
+			t,
+			0,
+			[]string{"small.txt", "large.txt", "medium.txt", "cat.png"},
+			[]attachment.Action{"", "", "", ""})
+
+		var buf strings.Builder
+		require.NoError(t, report.Write(&buf))
+		require.Equal(
+			t,
+			""+
+				"tokens  attachment  note\n"+
+				"7       small.txt   \n"+
+				"1006    large.txt   \n"+
+				"206     medium.txt  \n"+
+				"0       cat.png     image (not counted)\n"+
+				"1219    total       \n",
+			buf.String())
+	})
+
+	t.Run("truncate largest", func(t *testing.T) {
+		tester(
+			t,
+			500,
+			[]string{"small.txt", "large.txt", "medium.txt", "cat.png"},
+			[]attachment.Action{"", attachment.ActionTruncated, "", ""})
+	})
+
+	t.Run("skip too small to truncate", func(t *testing.T) {
+		tester(
+			t,
+			240,
+			[]string{"small.txt", "medium.txt", "cat.png"},
+			[]attachment.Action{"", attachment.ActionSkipped, "", ""})
+	})
+}
@@ -0,0 +1,349 @@
+package attachment
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/pastdev/askai/pkg/log"
+)
+
+// maxExtractedSize limits how much is read out of an archive, including any
+// archives nested within it, so that a small compressed file cannot expand
+// into something enormous.
+const maxExtractedSize = 64 << 20
+
+// errExtractLimit is returned once more than maxExtractedSize has been
+// extracted from a file.
+var errExtractLimit = fmt.Errorf("more than %d bytes extracted", maxExtractedSize)
+
+// extraction is the state shared by the extraction of a file and of the
+// archives nested within it.
+type extraction struct {
+	binary bool
+	// remaining is how many more bytes may be extracted across all levels of
+	// nested archives.
+	remaining int64
+}
+
+// extractor converts a file the model cannot read into one or more text
+// files.
+type extractor func(file File, x *extraction) ([]File, error)
+
+// notebookOut is an output of a jupyter notebook code cell.
+type notebookOut struct {
+	Data       map[string]notebookText `json:"data"`
+	EName      string                  `json:"ename"`
+	EValue     string                  `json:"evalue"`
+	OutputType string                  `json:"output_type"`
+	Stream     notebookText            `json:"text"`
+}
+
+// notebookText is multi-line text stored as either a string or an array of
+// lines.
+type notebookText string
+
+// extract returns the text files extracted from file, or file itself if there
+// is no extractor for it. Archives are expanded into their entries, skipping
+// binary entries unless binary is set. The raw content of a file that fails
+// to extract is of no use to the model so it is an error.
+func extract(file File, binary bool) ([]File, error) {
+	x := extraction{binary: binary, remaining: maxExtractedSize}
+	files, err := x.extract(file)
+	if err != nil {
+		return nil, fmt.Errorf("extract attachment %s: %w", file.Name, err)
+	}
+	return files, nil
+}
+
+// extract returns the files extracted from file, or file itself if there is
+// no extractor for it.
+func (x *extraction) extract(file File) ([]File, error) {
+	extractor := extractorFor(file)
+	if extractor == nil {
+		return []File{file}, nil
+	}
+	return extractor(file, x)
+}
+
+// read reads all of r, failing if that exceeds the remaining limit.
+func (x *extraction) read(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, x.remaining+1))
+	if err != nil {
+		return nil, err
+	}
+
+	x.remaining -= int64(len(content))
+	if x.remaining < 0 {
+		return nil, errExtractLimit
+	}
+	return content, nil
+}
+
+func extractorFor(file File) extractor {
+	name := strings.ToLower(file.Name)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTarGz
+	case file.MediaType == "application/zip" && !isOfficeDocument(name):
+		return extractZip
+	case strings.HasSuffix(name, ".tar") || isTar(file.Content):
+		return extractTar
+	case file.MediaType == "application/x-gzip":
+		return extractGzip
+	case file.MediaType == "application/pdf":
+		return textExtractor(extractPDFText, "text")
+	case strings.HasSuffix(name, ".ipynb"):
+		return textExtractor(extractNotebook, "markdown")
+	case file.MediaType == "text/html",
+		strings.HasSuffix(name, ".html"),
+		strings.HasSuffix(name, ".htm"):
+		return textExtractor(extractHTMLText, "text")
+	}
+	return nil
+}
+
+// extractArchiveEntry adds the entry of an archive to files, extracting it in
+// turn, unless it is binary and binary is not set. Entries that fail to
+// extract are skipped with a warning, unless the limit of the whole
+// extraction has been reached.
+func extractArchiveEntry(files []File, archive File, entry string, r io.Reader, x *extraction) ([]File, error) {
+	content, err := x.read(r)
+	if err != nil {
+		return files, fmt.Errorf("read %s: %w", entry, err)
+	}
+
+	mediaType, _, _ := strings.Cut(http.DetectContentType(content), ";")
+	name := archive.Name + "/" + path.Clean(entry)
+	extracted, err := x.extract(File{
+		Content:   content,
+		MediaType: mediaType,
+		Name:      name,
+	})
+	if errors.Is(err, errExtractLimit) {
+		return files, err
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("attachment", name).Msg("extract failed, skipping")
+		return files, nil
+	}
+	for _, file := range extracted {
+		if x.binary || file.IsText() || file.IsImage() {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func extractGzip(file File, x *extraction) ([]File, error) {
+	r, err := gzip.NewReader(bytes.NewReader(file.Content))
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+
+	content, err := x.read(r)
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+
+	mediaType, _, _ := strings.Cut(http.DetectContentType(content), ";")
+	return x.extract(File{
+		Content:   content,
+		MediaType: mediaType,
+		Name:      strings.TrimSuffix(file.Name, path.Ext(file.Name)),
+	})
+}
+
+func extractTar(file File, x *extraction) ([]File, error) {
+	return extractTarReader(file, bytes.NewReader(file.Content), x)
+}
+
+func extractTarGz(file File, x *extraction) ([]File, error) {
+	r, err := gzip.NewReader(bytes.NewReader(file.Content))
+	if err != nil {
+		return nil, fmt.Errorf("tar.gz: %w", err)
+	}
+	return extractTarReader(file, r, x)
+}
+
+func extractTarReader(file File, r io.Reader, x *extraction) ([]File, error) {
+	limited := &io.LimitedReader{R: r, N: maxExtractedSize}
+	tr := tar.NewReader(limited)
+
+	var files []File
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		files, err = extractArchiveEntry(files, file, header.Name, tr, x)
+		if err != nil {
+			return nil, fmt.Errorf("tar: %w", err)
+		}
+		if limited.N <= 0 {
+			return nil, fmt.Errorf("tar: more than %d bytes", maxExtractedSize)
+		}
+	}
+	return files, nil
+}
+
+func extractZip(file File, x *extraction) ([]File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(file.Content), int64(len(file.Content)))
+	if err != nil {
+		return nil, fmt.Errorf("zip: %w", err)
+	}
+
+	var files []File
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		// fail early on the declared size, the size read is checked as well
+		if entry.UncompressedSize64 > uint64(max(x.remaining, 0)) {
+			return nil, fmt.Errorf("zip: %w", errExtractLimit)
+		}
+
+		r, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("zip: %w", err)
+		}
+		files, err = extractArchiveEntry(files, file, entry.Name, r, x)
+		_ = r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("zip: %w", err)
+		}
+	}
+	return files, nil
+}
+
+// extractNotebook renders a jupyter notebook as markdown with the code cells
+// and their outputs in fenced blocks.
+func extractNotebook(content []byte) (string, error) {
+	var notebook struct {
+		Cells []struct {
+			CellType string        `json:"cell_type"`
+			Outputs  []notebookOut `json:"outputs"`
+			Source   notebookText  `json:"source"`
+		} `json:"cells"`
+		Metadata struct {
+			KernelSpec struct {
+				Language string `json:"language"`
+			} `json:"kernelspec"`
+			LanguageInfo struct {
+				Name string `json:"name"`
+			} `json:"language_info"`
+		} `json:"metadata"`
+	}
+	err := json.Unmarshal(content, &notebook)
+	if err != nil {
+		return "", fmt.Errorf("notebook: %w", err)
+	}
+
+	lang := notebook.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = notebook.Metadata.KernelSpec.Language
+	}
+
+	blocks := make([]string, 0, len(notebook.Cells))
+	for _, cell := range notebook.Cells {
+		source := strings.TrimRight(string(cell.Source), "\n")
+		switch cell.CellType {
+		case "code":
+			blocks = append(blocks, fence(lang, source))
+			for _, out := range cell.Outputs {
+				if text := out.String(); text != "" {
+					blocks = append(blocks, fence("output", text))
+				}
+			}
+		default:
+			blocks = append(blocks, source)
+		}
+	}
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+// isOfficeDocument returns true for the zip based office formats which are
+// not worth expanding as their entries are mostly xml markup.
+func isOfficeDocument(name string) bool {
+	for _, ext := range []string{".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".jar"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTar returns true if content has the ustar magic of a tar header.
+func isTar(content []byte) bool {
+	return len(content) > 262 && bytes.HasPrefix(content[257:], []byte("ustar"))
+}
+
+// textExtractor adapts a function that converts content to text into an
+// extractor of a single file with the content replaced by the text.
+func textExtractor(toText func([]byte) (string, error), lang string) extractor {
+	return func(file File, _ *extraction) ([]File, error) {
+		text, err := toText(file.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		file.Content = []byte(text)
+		file.Lang = lang
+		file.MediaType = "text/plain"
+		return []File{file}, nil
+	}
+}
+
+// String returns the text of the output, images are replaced by a
+// placeholder.
+func (o notebookOut) String() string {
+	var text string
+	switch o.OutputType {
+	case "stream":
+		text = string(o.Stream)
+	case "error":
+		text = o.EName + ": " + o.EValue
+	default:
+		text = string(o.Data["text/plain"])
+		for mediaType := range o.Data {
+			if strings.HasPrefix(mediaType, "image/") {
+				text = "[" + mediaType + " output]"
+				break
+			}
+		}
+	}
+	return strings.TrimRight(text, "\n")
+}
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	err := json.Unmarshal(data, &lines)
+	if err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+
+	var text string
+	err = json.Unmarshal(data, &text)
+	if err != nil {
+		return fmt.Errorf("notebook text: %w", err)
+	}
+	*t = notebookText(text)
+	return nil
+}
@@ -0,0 +1,219 @@
+package attachment_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/attachment"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadExtract(t *testing.T) {
+	dir := t.TempDir()
+
+	tester := func(t *testing.T, name string, content []byte, expected map[string]string) {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, content, 0600))
+
+		files, err := attachment.Load([]string{p})
+		require.NoError(t, err)
+
+		actual := map[string]string{}
+		for _, file := range files {
+			actual[file.Name] = string(file.Content)
+		}
+		require.Equal(t, expected, actual)
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range map[string]string{
+			"src/main.go": "package main",
+			"logo.bin":    "\x00\x01",
+		} {
+			w, err := zw.Create(name)
+			require.NoError(t, err)
+			_, err = w.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+
+		tester(t, "src.zip", buf.Bytes(), map[string]string{"src.zip/src/main.go": "package main"})
+	})
+
+	t.Run("tar.gz", func(t *testing.T) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0700}))
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/a.txt", Typeflag: tar.TypeReg, Mode: 0600, Size: 5}))
+		_, err := tw.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+
+		tester(t, "src.tar.gz", buf.Bytes(), map[string]string{"src.tar.gz/dir/a.txt": "hello"})
+	})
+
+	t.Run("html", func(t *testing.T) {
+		tester(
+			t,
+			"page.html",
+			[]byte(""+
+				"<!DOCTYPE html><html><head><title>Doc</title><style>p { color: red }</style></head>"+
+				"<body><h1>Intro</h1><p>Some   <b>bold</b>\n text &amp; more.</p>"+
+				"<script>alert('no')</script><ul><li>one</li><li>two</li></ul></body></html>"),
+			map[string]string{"page.html": "Doc\n# Intro\nSome bold text & more.\n- one\n- two"})
+	})
+
+	t.Run("ipynb", func(t *testing.T) {
+		tester(
+			t,
+			"analysis.ipynb",
+			[]byte(`{
+  "cells": [
+    {"cell_type": "markdown", "source": ["# Analysis\n", "of things"]},
+    {"cell_type": "code", "source": "print(1 + 1)", "outputs": [
+      {"output_type": "stream", "name": "stdout", "text": ["2\n"]},
+      {"output_type": "display_data", "data": {"image/png": "iVBOR", "text/plain": "<Figure>"}},
+      {"output_type": "error", "ename": "ValueError", "evalue": "bad"}
+    ]}
+  ],
+  "metadata": {"language_info": {"name": "python"}}
+}`),
+			map[string]string{
+				"analysis.ipynb": "" +
+					"# Analysis\nof things\n\n" +
+					"```python\nprint(1 + 1)\n```\n\n" +
+					"```output\n2\n```\n\n" +
+					"```output\n[image/png output]\n```\n\n" +
+					"```output\nValueError: bad\n```",
+			})
+	})
+
+	t.Run("pdf", func(t *testing.T) {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		_, err := zw.Write([]byte("BT /F1 12 Tf 72 712 Td [(Second) -250 (page)] TJ ET"))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		plain := "BT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj 0 -14 Td (world) Tj ET"
+		var pdf bytes.Buffer
+		fmt.Fprintf(&pdf, "%%PDF-1.4\n")
+		fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(plain), plain)
+		fmt.Fprintf(&pdf, "5 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+		pdf.Write(compressed.Bytes())
+		fmt.Fprintf(&pdf, "\nendstream\nendobj\n%%%%EOF\n")
+
+		tester(t, "doc.pdf", pdf.Bytes(), map[string]string{"doc.pdf": "Hello (PDF)\nworld\n\nSecond page"})
+	})
+
+	t.Run("pdf deeply nested arrays", func(t *testing.T) {
+		content := "BT (Hello) Tj " + strings.Repeat("[", 1_000_000) + " ET"
+		var pdf bytes.Buffer
+		fmt.Fprintf(&pdf, "%%PDF-1.4\n")
+		fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n%%%%EOF\n", len(content), content)
+
+		tester(t, "nested.pdf", pdf.Bytes(), map[string]string{"nested.pdf": "Hello"})
+	})
+}
+
+func TestLoadExtractFailed(t *testing.T) {
+	// the raw content of a file that fails to extract is of no use so it is
+	// not attached
+	dir := t.TempDir()
+
+	tester := func(t *testing.T, name string, content []byte, expectedErr string) {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, content, 0600))
+
+		_, err := attachment.Load([]string{p})
+		require.ErrorContains(t, err, expectedErr)
+	}
+
+	t.Run("pdf without text", func(t *testing.T) {
+		tester(
+			t,
+			"scan.pdf",
+			[]byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n"),
+			"extract attachment scan.pdf: pdf: no extractable text")
+	})
+
+	t.Run("corrupt zip", func(t *testing.T) {
+		tester(t, "src.zip", []byte("PK\x03\x04broken"), "extract attachment src.zip: zip:")
+	})
+}
+
+func TestLoadExtractSkipsFailedEntries(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"notes.txt": "hello",
+		"scan.pdf":  "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n",
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	p := filepath.Join(t.TempDir(), "docs.zip")
+	require.NoError(t, os.WriteFile(p, buf.Bytes(), 0600))
+
+	files, err := attachment.Load([]string{p})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "docs.zip/notes.txt", files[0].Name)
+}
+
+func TestLoadExtractWalk(t *testing.T) {
+	// extraction is limited to files named explicitly, a walked directory of
+	// html sources is attached as source
+	dir := t.TempDir()
+	source := "<html><body><p>hello</p></body></html>"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte(source), 0600))
+
+	files, err := attachment.Load([]string{dir})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, source, string(files[0].Content))
+}
+
+func TestLoadExtractNestedLimit(t *testing.T) {
+	// each nested archive is within the limit, together they exceed it
+	entry := func(name string) (*tar.Header, []byte) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, err := gw.Write(bytes.Repeat([]byte("a"), 40<<20))
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(buf.Len())}, buf.Bytes()
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a.txt.gz", "b.txt.gz"} {
+		header, content := entry(name)
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	p := filepath.Join(t.TempDir(), "nested.tar")
+	require.NoError(t, os.WriteFile(p, buf.Bytes(), 0600))
+
+	_, err := attachment.Load([]string{p})
+	require.ErrorContains(t, err, "extract attachment nested.tar: tar: gzip: more than 67108864 bytes extracted")
+}
@@ -0,0 +1,197 @@
+package attachment
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single pattern from a .gitignore file.
+type ignoreRule struct {
+	// base is the slash separated directory containing the .gitignore, rules
+	// only apply to paths below it.
+	base    string
+	dirOnly bool
+	negate  bool
+	re      *regexp.Regexp
+}
+
+// ignoreRules is an ordered list of rules where the last matching rule wins
+// just like git.
+type ignoreRules []ignoreRule
+
+// compileGlob converts a glob pattern into an anchored regular expression
+// matched against slash separated paths. In addition to the path.Match syntax
+// (*, ?, and [...]), ** matches any number of directories.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					re.WriteString("(?:.*/)?")
+				} else {
+					re.WriteString(".*")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("glob %s: unterminated [", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				c = pattern[i]
+			}
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", pattern, err)
+	}
+	return compiled, nil
+}
+
+// hasMeta returns true if pattern contains any glob syntax.
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globRoot returns the longest leading directory of pattern that contains no
+// glob syntax, which is where a walk for matches must start.
+func globRoot(pattern string) string {
+	i := strings.IndexAny(pattern, "*?[")
+	if i < 0 {
+		return pattern
+	}
+	j := strings.LastIndexByte(pattern[:i], '/')
+	if j < 0 {
+		return "."
+	}
+	if j == 0 {
+		return "/"
+	}
+	return pattern[:j]
+}
+
+// loadParentIgnoreFiles returns the rules of the .gitignore files in the
+// directories above the slash separated absolute path dir, from the root of
+// its repository down. If dir is not in a repository there are none.
+func loadParentIgnoreFiles(dir string) (ignoreRules, error) {
+	var parents []string
+	for {
+		_, err := os.Stat(path.Join(dir, ".git"))
+		if err == nil {
+			break
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+		parents = append(parents, dir)
+	}
+
+	var rules ignoreRules
+	for i := len(parents) - 1; i >= 0; i-- {
+		var err error
+		rules, err = rules.loadIgnoreFile(parents[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// loadIgnoreFile appends the rules of the .gitignore in dir, if there is one.
+func (r ignoreRules) loadIgnoreFile(dir string) (ignoreRules, error) {
+	data, err := os.ReadFile(path.Join(dir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return r, fmt.Errorf("read gitignore: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// patterns without a slash match at any depth, otherwise they are
+		// relative to the directory of the .gitignore
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+
+		rule.re, err = compileGlob(line)
+		if err != nil {
+			return r, fmt.Errorf("gitignore %s: %w", dir, err)
+		}
+		r = append(r, rule)
+	}
+
+	return r, nil
+}
+
+// Ignored returns true if the slash separated path p is ignored.
+func (r ignoreRules) Ignored(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		rel := p
+		if rule.base != "." {
+			base := strings.TrimSuffix(rule.base, "/") + "/"
+			if !strings.HasPrefix(p, base) {
+				continue
+			}
+			rel = p[len(base):]
+		}
+
+		if rule.re.MatchString(rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
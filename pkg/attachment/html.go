@@ -0,0 +1,134 @@
+package attachment
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// htmlBlockTags start on a new line.
+	htmlBlockTags = map[string]bool{
+		"address": true, "article": true, "aside": true, "blockquote": true,
+		"br": true, "dd": true, "div": true, "dl": true, "dt": true,
+		"figcaption": true, "figure": true, "footer": true, "form": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"header": true, "hr": true, "li": true, "main": true, "nav": true,
+		"ol": true, "p": true, "pre": true, "section": true, "table": true,
+		"title": true, "tr": true, "ul": true,
+	}
+	// htmlSkipTags have content that is not readable text.
+	htmlSkipTags = map[string]bool{
+		"iframe": true, "noscript": true, "object": true,
+		"script": true, "style": true, "svg": true, "template": true,
+	}
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	whitespace = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// extractHTMLText returns the readable text of an html document. Scripts,
+// styles and the like are dropped, block elements are separated by lines,
+// headings are prefixed with # and list items with -.
+func extractHTMLText(content []byte) (string, error) {
+	var text strings.Builder
+	doc := string(content)
+	skip := ""
+	pre := 0
+	// lineStart is true when nothing has been written to the current line
+	lineStart := true
+
+	write := func(s string) {
+		if s != "" {
+			text.WriteString(s)
+			lineStart = strings.HasSuffix(s, "\n")
+		}
+	}
+	newline := func() {
+		if !lineStart {
+			write("\n")
+		}
+	}
+
+	for doc != "" {
+		i := strings.IndexByte(doc, '<')
+		if i < 0 {
+			i = len(doc)
+		}
+
+		if skip == "" && i > 0 {
+			chunk := html.UnescapeString(doc[:i])
+			if pre == 0 {
+				chunk = whitespace.ReplaceAllString(chunk, " ")
+				if lineStart {
+					chunk = strings.TrimLeft(chunk, " ")
+				}
+			}
+			write(chunk)
+		}
+		doc = doc[i:]
+		if doc == "" {
+			break
+		}
+
+		if strings.HasPrefix(doc, "<!--") {
+			end := strings.Index(doc, "-->")
+			if end < 0 {
+				break
+			}
+			doc = doc[end+3:]
+			continue
+		}
+
+		end := strings.IndexByte(doc, '>')
+		if end < 0 {
+			break
+		}
+		tag := doc[1:end]
+		doc = doc[end+1:]
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimPrefix(tag, "/"))
+		name, _, _ = strings.Cut(name, " ")
+		name = strings.TrimRight(name, "/\t\r\n")
+
+		if skip != "" {
+			if closing && name == skip {
+				skip = ""
+			}
+			continue
+		}
+		if htmlSkipTags[name] && !closing && !strings.HasSuffix(tag, "/") {
+			skip = name
+			continue
+		}
+
+		if name == "pre" {
+			if closing {
+				pre = max(0, pre-1)
+			} else {
+				pre++
+			}
+		}
+
+		if htmlBlockTags[name] {
+			newline()
+			if !closing {
+				switch name {
+				case "h1", "h2", "h3", "h4", "h5", "h6":
+					write(strings.Repeat("#", int(name[1]-'0')) + " ")
+				case "li":
+					write("- ")
+				}
+			}
+		} else if (name == "td" || name == "th") && !closing && !lineStart {
+			write("\t")
+		}
+	}
+
+	lines := strings.Split(text.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	result := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(result), nil
+}
@@ -0,0 +1,374 @@
+package attachment
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfMaxArrayDepth limits the nesting of arrays in a content stream, deeper
+// arrays are never valid and would otherwise recurse without bound.
+const pdfMaxArrayDepth = 32
+
+var (
+	pdfFilter = regexp.MustCompile(`/Filter\s*(?:\[\s*)?/(\w+)`)
+	pdfStream = regexp.MustCompile(`stream\r?\n`)
+)
+
+// pdfOperator is an operator of a content stream such as Tj.
+type pdfOperator string
+
+// pdfString is a literal or hex string of a content stream.
+type pdfString []byte
+
+// pdfLexer reads the tokens of a pdf content stream.
+type pdfLexer struct {
+	data []byte
+	// depth is the number of arrays being read.
+	depth int
+	pos   int
+}
+
+// extractPDFText returns the text shown by the content streams of a pdf. This
+// is a best effort extraction that handles uncompressed and flate compressed
+// streams using simple font encodings, which covers most documents produced
+// by office software and typesetters. Text in scanned documents or fonts with
+// custom encodings cannot be extracted.
+func extractPDFText(content []byte) (string, error) {
+	var text strings.Builder
+	// the limit applies to all of the streams of the file together
+	remaining := int64(maxExtractedSize)
+	for _, loc := range pdfStream.FindAllIndex(content, -1) {
+		if bytes.HasSuffix(content[:loc[0]], []byte("end")) {
+			continue
+		}
+
+		start := loc[1]
+		end := bytes.Index(content[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := content[start : start+end]
+
+		// the stream dictionary is between the start of the object and the
+		// stream keyword
+		dict := content[:loc[0]]
+		if i := bytes.LastIndex(dict, []byte(" obj")); i >= 0 {
+			dict = dict[i:]
+		}
+
+		filter := ""
+		if m := pdfFilter.FindSubmatch(dict); m != nil {
+			filter = string(m[1])
+		}
+		switch filter {
+		case "":
+		case "FlateDecode":
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// streams are often followed by garbage or truncated, so take
+			// whatever could be decompressed
+			data, _ = io.ReadAll(io.LimitReader(r, remaining+1))
+			_ = r.Close()
+			remaining -= int64(len(data))
+			if remaining < 0 {
+				return "", fmt.Errorf("pdf: %w", errExtractLimit)
+			}
+		default:
+			// images and other encodings never contain text
+			continue
+		}
+
+		if bytes.Contains(data, []byte("BT")) {
+			text.WriteString(pdfContentText(data))
+		}
+	}
+
+	result := strings.TrimSpace(blankLines.ReplaceAllString(text.String(), "\n\n"))
+	if result == "" {
+		return "", errors.New("pdf: no extractable text")
+	}
+	return result, nil
+}
+
+// pdfContentText returns the text shown by the text operators of a content
+// stream with lines separated by newlines.
+func pdfContentText(data []byte) string {
+	var text strings.Builder
+	var operands []any
+	lexer := pdfLexer{data: data}
+	for {
+		token, ok := lexer.Next()
+		if !ok {
+			break
+		}
+
+		op, isOp := token.(pdfOperator)
+		if !isOp {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch op {
+		case "Tj":
+			writePDFStrings(&text, operands)
+		case "'", "\"":
+			text.WriteString("\n")
+			writePDFStrings(&text, operands)
+		case "TJ":
+			for _, operand := range operands {
+				array, ok := operand.([]any)
+				if !ok {
+					continue
+				}
+				for _, element := range array {
+					switch v := element.(type) {
+					case pdfString:
+						text.WriteString(v.Text())
+					case float64:
+						// large negative adjustments are the gaps between words
+						if v < -200 {
+							text.WriteString(" ")
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) == 2 {
+				if ty, ok := operands[1].(float64); ok && ty != 0 {
+					text.WriteString("\n")
+				} else {
+					text.WriteString(" ")
+				}
+			}
+		case "T*", "ET":
+			text.WriteString("\n")
+		}
+		operands = operands[:0]
+	}
+	return text.String()
+}
+
+func writePDFStrings(text *strings.Builder, operands []any) {
+	for _, operand := range operands {
+		if s, ok := operand.(pdfString); ok {
+			text.WriteString(s.Text())
+		}
+	}
+}
+
+// Text decodes the string which is either UTF-16 (with a byte order mark, or
+// detected by the zero high bytes of ascii text) or a single byte encoding
+// which is treated as Latin-1.
+func (s pdfString) Text() string {
+	if len(s) >= 2 && len(s)%2 == 0 {
+		utf16be := bytes.HasPrefix(s, []byte{0xfe, 0xff})
+		if !utf16be {
+			zeros := 0
+			for i := 0; i < len(s); i += 2 {
+				if s[i] == 0 {
+					zeros++
+				}
+			}
+			utf16be = zeros == len(s)/2
+		}
+
+		if utf16be {
+			codes := make([]uint16, 0, len(s)/2)
+			for i := 0; i < len(s); i += 2 {
+				codes = append(codes, uint16(s[i])<<8|uint16(s[i+1]))
+			}
+			return strings.TrimPrefix(string(utf16.Decode(codes)), "\ufeff")
+		}
+	}
+
+	runes := make([]rune, 0, len(s))
+	for _, b := range s {
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
+
+// Next returns the next token which is a float64, pdfString, []any (array),
+// pdfOperator, or string (name, dictionary delimiters and anything else that
+// is not interesting).
+func (l *pdfLexer) Next() (any, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString(), true
+	case c == '<' && l.peek(1) == '<', c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return string(c) + string(c), true
+	case c == '<':
+		return l.hexString(), true
+	case c == '[':
+		l.pos++
+		if l.depth >= pdfMaxArrayDepth {
+			return "[", true
+		}
+		l.depth++
+		defer func() { l.depth-- }()
+
+		var array []any
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return array, true
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return array, true
+			}
+			token, ok := l.Next()
+			if !ok {
+				return array, true
+			}
+			array = append(array, token)
+		}
+	case c == '/':
+		start := l.pos
+		l.pos++
+		l.skipRegular()
+		return string(l.data[start:l.pos]), true
+	case c == ']' || c == '>' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return string(c), true
+	}
+
+	start := l.pos
+	l.skipRegular()
+	if l.pos == start {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n, true
+	}
+	return pdfOperator(word), true
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if isHexDigit(l.data[l.pos]) {
+			digits = append(digits, l.data[l.pos])
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	s := make(pdfString, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		b, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		s = append(s, byte(b))
+	}
+	return s
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++
+	var s pdfString
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return s
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// line continuation
+				if c == '\r' && l.peek(0) == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					code := int(c - '0')
+					for n := 0; n < 2 && l.peek(0) >= '0' && l.peek(0) <= '7'; n++ {
+						code = code*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(code)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+func (l *pdfLexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *pdfLexer) skipRegular() {
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !strings.ContainsRune("()<>[]{}/%", rune(l.data[l.pos])) {
+		l.pos++
+	}
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
@@ -12,11 +12,22 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+// InterruptedMarker ends a response saved to a conversation when the request
+// was cancelled or failed before the response was complete.
+const InterruptedMarker = "[response interrupted]"
+
 type Conversation interface {
 	Continue(openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error)
 	UpdateResponse(string) error
 }
 
+type SendReplyOption func(*SendReplyOptions)
+
+type SendReplyOptions struct {
+	choice    int
+	reasoning bool
+}
+
 func HandleBufferResponse(
 	ctx context.Context,
 	client *openai.Client,
@@ -33,19 +44,21 @@ func HandleBufferResponse(
 		return fmt.Errorf("chat completion: %w", err)
 	}
 
+	// the response is written before tool calls are handled so that writers
+	// see the exchange in the order it happened
+	err = writer.Write(resp)
+	if err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+
 	log.Debug().Interface("resp", resp).Msg("before invoking tool")
-	if len(resp.Choices[0].Message.ToolCalls) > 0 {
+	if len(resp.Choices) > 0 && len(resp.Choices[0].Message.ToolCalls) > 0 {
 		err = handleToolCalls(ctx, client, req, resp, writer)
 		if err != nil {
 			return fmt.Errorf("handle tool calls: %w", err)
 		}
 	}
 
-	err = writer.Write(resp)
-	if err != nil {
-		return fmt.Errorf("write response: %w", err)
-	}
-
 	return nil
 }
 
@@ -56,6 +69,7 @@ func handleToolCalls(
 	resp openai.ChatCompletionResponse,
 	writer ResponseWriter,
 ) error {
+	log.Debug().Interface("usage", resp.Usage).Msg("tool call round usage")
 	toolCalls := resp.Choices[0].Message.ToolCalls
 	toolCallCompletionMessages := make([]openai.ChatCompletionMessage, 0, len(toolCalls))
 
@@ -137,6 +151,10 @@ func HandleStreamResponse(
 		res, err := strm.Recv()
 		if errors.Is(err, io.EOF) {
 			log.Trace().Err(err).Msg("reached end of streaming response")
+			err = flushStream(writer)
+			if err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
 			return nil
 		} else if err != nil {
 			return fmt.Errorf("stream response: %w", err)
@@ -175,21 +193,65 @@ func SendReply(
 	conversation Conversation,
 	reply openai.ChatCompletionRequest,
 	writer ResponseWriter,
+	opts ...SendReplyOption,
 ) error {
+	sendOpts := SendReplyOptions{}
+	for _, opt := range opts {
+		opt(&sendOpts)
+	}
+
 	req, err := conversation.Continue(reply)
 	if err != nil {
 		return fmt.Errorf("continue: %w", err)
 	}
 
-	buf := NewResponseWriterContentBuffer(writer)
-	err = Send(ctx, client, req, buf)
-	if err != nil {
-		return fmt.Errorf("send: %w", err)
+	// validated against the request after the conversation defaults are
+	// applied, servers treat an unset n as 1
+	n := max(req.N, 1)
+	if sendOpts.choice < 0 || sendOpts.choice >= n {
+		return fmt.Errorf("choice %d out of range for n %d", sendOpts.choice, n)
+	}
+
+	buf := NewResponseWriterContentBufferForChoice(writer, sendOpts.choice)
+	sendErr := Send(ctx, client, req, buf)
+	if sendErr != nil {
+		buf.flushPending()
+		if buf.String() == "" && buf.Reasoning() == "" {
+			return fmt.Errorf("send: %w", sendErr)
+		}
+	}
+
+	response := buf.String()
+	if sendOpts.reasoning {
+		response = formatReasoning(buf.Reasoning()) + response
+	}
+	if sendErr != nil {
+		// keep what was streamed before the request was cancelled or failed
+		response += "\n\n" + InterruptedMarker
 	}
 
-	err = conversation.UpdateResponse(buf.String())
+	err = conversation.UpdateResponse(response)
 	if err != nil {
-		return fmt.Errorf("update response: %w", err)
+		return errors.Join(sendErr, fmt.Errorf("update response: %w", err))
+	}
+	if sendErr != nil {
+		return fmt.Errorf("send: %w", sendErr)
 	}
 	return nil
 }
+
+// WithChoice selects which choice is saved to the conversation when multiple
+// choices are requested.
+func WithChoice(index int) SendReplyOption {
+	return func(o *SendReplyOptions) {
+		o.choice = index
+	}
+}
+
+// WithReasoning saves the reasoning of the response to the conversation, in
+// think tags, ahead of the content. By default reasoning is not saved.
+func WithReasoning() SendReplyOption {
+	return func(o *SendReplyOptions) {
+		o.reasoning = true
+	}
+}
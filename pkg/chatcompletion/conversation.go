@@ -11,11 +11,39 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+var (
+	_ Conversation = &MemoryConversation{}
+	_ Conversation = &PersistentConversation{}
+)
+
+// MemoryConversation is a conversation that is only kept in memory, it can be
+// saved as a named conversation using NewPersistentConversation.
+type MemoryConversation struct {
+	Request openai.ChatCompletionRequest
+}
+
 type PersistentConversation struct {
 	name    string
 	request openai.ChatCompletionRequest
 }
 
+// NewMemoryConversation returns a new conversation starting from defaults.
+func NewMemoryConversation(defaults openai.ChatCompletionRequest) (*MemoryConversation, error) {
+	c := MemoryConversation{}
+	err := deepCopy(&c.Request, &defaults)
+	if err != nil {
+		return nil, fmt.Errorf("deep copy defaults: %w", err)
+	}
+	return &c, nil
+}
+
+// NewPersistentConversation returns a conversation by the supplied name
+// containing request, replacing anything previously saved by that name once
+// saved.
+func NewPersistentConversation(name string, request openai.ChatCompletionRequest) PersistentConversation {
+	return PersistentConversation{name: name, request: request}
+}
+
 // LoadPersistentConversation will load an existing conversation by the supplied
 // name or create it if it does not exist.
 func LoadPersistentConversation(
@@ -48,39 +76,45 @@ func LoadPersistentConversation(
 	return c, nil
 }
 
-func (c *PersistentConversation) Continue(
+func (c *MemoryConversation) Continue(
 	reply openai.ChatCompletionRequest,
 ) (openai.ChatCompletionRequest, error) {
-	// originally:
-	//   messages := append(c.request.Messages, reply.Messages...)
-	// but append actually modifies and returns the first argument so it was
-	// a reference to the c.request.Message that then got modified by the
-	// deepCopy call causing the reply to replace the first message (system):
-	//   https://github.com/pastdev/askai/issues/1
-	// so we need to create a new array to avoid this
-	messages := make(
-		[]openai.ChatCompletionMessage,
-		0,
-		len(c.request.Messages)+len(reply.Messages))
-	messages = append(messages, c.request.Messages...)
-	messages = append(messages, reply.Messages...)
-
-	err := deepCopy(&c.request, &reply)
+	request, err := continueRequest(c.Request, reply)
 	if err != nil {
-		return openai.ChatCompletionRequest{}, fmt.Errorf("deep copy reply: %w", err)
+		return openai.ChatCompletionRequest{}, err
 	}
-	c.request.Messages = messages
-	return c.request, nil
+	c.Request = request
+	return request, nil
 }
 
-func (c PersistentConversation) UpdateResponse(response string) error {
-	c.request.Messages = append(
-		c.request.Messages,
+func (c *MemoryConversation) UpdateResponse(response string) error {
+	c.Request.Messages = append(
+		c.Request.Messages,
 		openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleAssistant,
 			Content: response,
 		})
+	return nil
+}
+
+func (c *PersistentConversation) Continue(
+	reply openai.ChatCompletionRequest,
+) (openai.ChatCompletionRequest, error) {
+	request, err := continueRequest(c.request, reply)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+	c.request = request
+	return request, nil
+}
+
+// Request returns the request containing the whole conversation so far.
+func (c PersistentConversation) Request() openai.ChatCompletionRequest {
+	return c.request
+}
 
+// Save writes the conversation to its file.
+func (c PersistentConversation) Save() error {
 	data, err := json.Marshal(c.request)
 	if err != nil {
 		return fmt.Errorf("marshal %s: %w", c.name, err)
@@ -93,12 +127,57 @@ func (c PersistentConversation) UpdateResponse(response string) error {
 
 	err = os.WriteFile(conversationFile(c.name), data, 0600)
 	if err != nil {
-		return fmt.Errorf("write response: %w", err)
+		return fmt.Errorf("write %s: %w", c.name, err)
 	}
 
 	return nil
 }
 
+func (c PersistentConversation) UpdateResponse(response string) error {
+	c.request.Messages = append(
+		c.request.Messages,
+		openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: response,
+		})
+
+	err := c.Save()
+	if err != nil {
+		return fmt.Errorf("save response: %w", err)
+	}
+	return nil
+}
+
+// continueRequest returns request with the messages of reply appended and
+// any other fields of reply replacing those of request.
+func continueRequest(
+	request openai.ChatCompletionRequest,
+	reply openai.ChatCompletionRequest,
+) (openai.ChatCompletionRequest, error) {
+	// originally:
+	//   messages := append(request.Messages, reply.Messages...)
+	// but append actually modifies and returns the first argument so it was
+	// a reference to the request.Message that then got modified by the
+	// deepCopy call causing the reply to replace the first message (system):
+	//   https://github.com/pastdev/askai/issues/1
+	// so we need to create a new array to avoid this
+	messages := make(
+		[]openai.ChatCompletionMessage,
+		0,
+		len(request.Messages)+len(reply.Messages))
+	messages = append(messages, request.Messages...)
+	messages = append(messages, reply.Messages...)
+
+	// detach from the callers messages so the deepCopy cannot write into them
+	request.Messages = nil
+	err := deepCopy(&request, &reply)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, fmt.Errorf("deep copy reply: %w", err)
+	}
+	request.Messages = messages
+	return request, nil
+}
+
 func conversationDir() string {
 	dir, ok := os.LookupEnv("XDG_DATA_HOME")
 	if ok {
@@ -0,0 +1,143 @@
+package chatcompletion_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryConversation(t *testing.T) {
+	system := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "be brief"}
+	question := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hi"}
+	answer := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "hello"}
+
+	defaults := openai.ChatCompletionRequest{
+		Model:    "default",
+		Messages: []openai.ChatCompletionMessage{system},
+	}
+	conv, err := chatcompletion.NewMemoryConversation(defaults)
+	require.NoError(t, err)
+
+	req, err := conv.Continue(openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{question},
+		Stream:   true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "default", req.Model)
+	require.True(t, req.Stream)
+	require.Equal(t, []openai.ChatCompletionMessage{system, question}, req.Messages)
+	// the defaults must not be modified
+	require.Equal(t, []openai.ChatCompletionMessage{system}, defaults.Messages)
+
+	require.NoError(t, conv.UpdateResponse("hello"))
+	require.Equal(t, []openai.ChatCompletionMessage{system, question, answer}, conv.Request.Messages)
+}
+
+func TestPersistentConversationSave(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "hello"},
+	}
+	conv := chatcompletion.NewPersistentConversation(
+		"saved",
+		openai.ChatCompletionRequest{Model: "m", Messages: messages})
+	require.NoError(t, conv.Save())
+
+	loaded, err := chatcompletion.LoadPersistentConversation("saved", openai.ChatCompletionRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "m", loaded.Request().Model)
+	require.Equal(t, messages, loaded.Request().Messages)
+}
+
+// cancellingResponseWriter cancels the request once the first chunk is
+// written, as if Ctrl-C was pressed while the response was streaming.
+type cancellingResponseWriter struct {
+	chatcompletion.ResponseWriter
+	cancel context.CancelFunc
+}
+
+func (w *cancellingResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
+	err := w.ResponseWriter.WriteStream(res)
+	w.cancel()
+	return err
+}
+
+func TestSendReplyInterrupted(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"hello"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	clientCfg := openai.DefaultConfig("")
+	clientCfg.BaseURL = server.URL
+	client := openai.NewClientWithConfig(clientCfg)
+
+	conv, err := chatcompletion.LoadPersistentConversation("interrupted", openai.ChatCompletionRequest{Model: "m"})
+	require.NoError(t, err)
+
+	question := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hi"}
+	err = chatcompletion.SendReply(
+		ctx,
+		client,
+		&conv,
+		openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{question}, Stream: true},
+		&cancellingResponseWriter{
+			ResponseWriter: &chatcompletion.ContentResponseWriter{W: io.Discard},
+			cancel:         cancel,
+		})
+	require.ErrorIs(t, err, context.Canceled)
+
+	loaded, err := chatcompletion.LoadPersistentConversation("interrupted", openai.ChatCompletionRequest{})
+	require.NoError(t, err)
+	require.Equal(t,
+		[]openai.ChatCompletionMessage{
+			question,
+			{Role: openai.ChatMessageRoleAssistant, Content: "hello\n\n" + chatcompletion.InterruptedMarker},
+		},
+		loaded.Request().Messages)
+}
+
+func TestSendReplyChoiceOutOfRange(t *testing.T) {
+	tester := func(t *testing.T, defaults openai.ChatCompletionRequest, choice int, expected string) {
+		conv, err := chatcompletion.NewMemoryConversation(defaults)
+		require.NoError(t, err)
+
+		err = chatcompletion.SendReply(
+			context.Background(),
+			nil,
+			conv,
+			openai.ChatCompletionRequest{
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			},
+			&chatcompletion.ContentResponseWriter{W: io.Discard},
+			chatcompletion.WithChoice(choice))
+		require.EqualError(t, err, expected)
+	}
+
+	t.Run("unset n", func(t *testing.T) {
+		tester(t, openai.ChatCompletionRequest{}, 1, "choice 1 out of range for n 1")
+	})
+	t.Run("n from defaults", func(t *testing.T) {
+		tester(t, openai.ChatCompletionRequest{N: 2}, 2, "choice 2 out of range for n 2")
+	})
+	t.Run("negative", func(t *testing.T) {
+		tester(t, openai.ChatCompletionRequest{}, -1, "choice -1 out of range for n 1")
+	})
+}
@@ -0,0 +1,152 @@
+package chatcompletion
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// StreamFlusher is implemented by ResponseWriters that hold back stream
+// chunks and need to be told when the stream has ended so they can write
+// whatever remains.
+type StreamFlusher interface {
+	FlushStream() error
+}
+
+// streamDemultiplexer orders stream chunks by choice so that each choice is
+// emitted in full before the next one starts. When multiple choices are
+// requested (n>1) the server interleaves their chunks, so chunks for any
+// choice other than the one currently being emitted are held until it
+// finishes. The zero value is ready to use.
+type streamDemultiplexer struct {
+	current  int
+	finished map[int]bool
+	pending  map[int][]openai.ChatCompletionStreamResponse
+	trailing []openai.ChatCompletionStreamResponse
+}
+
+// Flush emits all chunks still being held in choice order and resets the
+// demultiplexer for the next stream.
+func (d *streamDemultiplexer) Flush(emit func(openai.ChatCompletionStreamResponse) error) error {
+	indexes := make([]int, 0, len(d.pending))
+	for index := range d.pending {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+
+	chunks := make([]openai.ChatCompletionStreamResponse, 0)
+	for _, index := range indexes {
+		chunks = append(chunks, d.pending[index]...)
+	}
+	chunks = append(chunks, d.trailing...)
+	*d = streamDemultiplexer{}
+
+	for _, chunk := range chunks {
+		err := emit(chunk)
+		if err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+	return nil
+}
+
+// Write splits res into single choice chunks and emits each one that belongs
+// to the current choice, holding the rest until their turn.
+func (d *streamDemultiplexer) Write(
+	res openai.ChatCompletionStreamResponse,
+	emit func(openai.ChatCompletionStreamResponse) error,
+) error {
+	if len(res.Choices) == 0 {
+		// usage only chunks are sent after all choices have finished
+		if len(d.pending) == 0 {
+			return emit(res)
+		}
+		d.trailing = append(d.trailing, res)
+		return nil
+	}
+
+	for i, choice := range res.Choices {
+		chunk := res
+		chunk.Choices = []openai.ChatCompletionStreamChoice{choice}
+		if i < len(res.Choices)-1 {
+			chunk.Usage = nil
+		}
+
+		if choice.Index != d.current {
+			if d.pending == nil {
+				d.pending = map[int][]openai.ChatCompletionStreamResponse{}
+				d.finished = map[int]bool{}
+			}
+			d.pending[choice.Index] = append(d.pending[choice.Index], chunk)
+			if isFinished(choice.FinishReason) {
+				d.finished[choice.Index] = true
+			}
+			continue
+		}
+
+		err := emit(chunk)
+		if err != nil {
+			return err
+		}
+
+		if isFinished(choice.FinishReason) {
+			d.current++
+			err := d.drain(emit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *streamDemultiplexer) drain(emit func(openai.ChatCompletionStreamResponse) error) error {
+	for {
+		chunks, ok := d.pending[d.current]
+		if !ok {
+			break
+		}
+		delete(d.pending, d.current)
+
+		for _, chunk := range chunks {
+			err := emit(chunk)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !d.finished[d.current] {
+			break
+		}
+		delete(d.finished, d.current)
+		d.current++
+	}
+
+	if len(d.pending) == 0 {
+		trailing := d.trailing
+		d.trailing = nil
+		for _, chunk := range trailing {
+			err := emit(chunk)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func flushStream(writer ResponseWriter) error {
+	flusher, ok := writer.(StreamFlusher)
+	if !ok {
+		return nil
+	}
+
+	err := flusher.FlushStream()
+	if err != nil {
+		return fmt.Errorf("flush stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package chatcompletion
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// editScissors separates the message from the template, it and
+	// everything after it is removed from the edited message.
+	editScissors = "# ------------------------ >8 ------------------------"
+	// editTurns is the number of the most recent conversation messages shown
+	// in the template.
+	editTurns = 6
+)
+
+// ErrEditCancelled is returned when the edited message is empty.
+var ErrEditCancelled = errors.New("empty message, request cancelled")
+
+// EditTemplate returns the content of a file to write a message in. Below a
+// scissors line it lists, commented out, the system messages and the last few
+// turns of history.
+func EditTemplate(system, history []openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	b.WriteString("\n\n")
+	b.WriteString(editScissors + "\n")
+	b.WriteString("# Do not modify or remove the line above, everything below it is ignored.\n")
+	b.WriteString("# Write your message above it, an empty message cancels the request.\n")
+
+	writeMessages := func(heading string, messages []openai.ChatCompletionMessage) {
+		if len(messages) == 0 {
+			return
+		}
+		b.WriteString("#\n# " + heading + ":\n")
+		for _, msg := range messages {
+			b.WriteString("#\n# [" + msg.Role + "]\n")
+			for _, line := range strings.Split(strings.TrimRight(translate.MessageText(msg), "\n"), "\n") {
+				b.WriteString(strings.TrimRight("#   "+line, " ") + "\n")
+			}
+		}
+	}
+
+	writeMessages("system messages", system)
+	if len(history) > editTurns {
+		history = history[len(history)-editTurns:]
+	}
+	writeMessages("recent conversation", history)
+	return b.String()
+}
+
+// ParseEditedMessage returns the message written above the scissors line of
+// a file that started as an EditTemplate. If it is empty, ErrEditCancelled
+// is returned.
+func ParseEditedMessage(content string) (string, error) {
+	if i := strings.Index(content, editScissors); i >= 0 {
+		content = content[:i]
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", ErrEditCancelled
+	}
+	return content, nil
+}
@@ -0,0 +1,77 @@
+package chatcompletion_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditTemplate(t *testing.T) {
+	system := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+	}
+	var history []openai.ChatCompletionMessage
+	for i := 1; i <= 7; i++ {
+		history = append(history, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: fmt.Sprintf("question %d", i),
+		})
+	}
+	history[6].MultiContent = []openai.ChatMessagePart{
+		{Type: openai.ChatMessagePartTypeText, Text: "look at\nthis  "},
+		{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,aGk="}},
+	}
+	history[6].Content = ""
+
+	template := chatcompletion.EditTemplate(system, history)
+	require.Equal(
+		t,
+		""+
+			"\n\n"+
+			"# ------------------------ >8 ------------------------\n"+
+			"# Do not modify or remove the line above, everything below it is ignored.\n"+
+			"# Write your message above it, an empty message cancels the request.\n"+
+			"#\n# system messages:\n"+
+			"#\n# [system]\n#   be brief\n"+
+			"#\n# recent conversation:\n"+
+			"#\n# [user]\n#   question 2\n"+
+			"#\n# [user]\n#   question 3\n"+
+			"#\n# [user]\n#   question 4\n"+
+			"#\n# [user]\n#   question 5\n"+
+			"#\n# [user]\n#   question 6\n"+
+			"#\n# [user]\n#   look at\n#   this\n",
+		template)
+}
+
+func TestParseEditedMessage(t *testing.T) {
+	template := chatcompletion.EditTemplate(
+		[]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "be brief"}},
+		[]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "earlier"}})
+
+	tester := func(t *testing.T, content string, expected string, expectedErr error) {
+		message, err := chatcompletion.ParseEditedMessage(content)
+		if expectedErr != nil {
+			require.ErrorIs(t, err, expectedErr)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, expected, message)
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		tester(t, template, "", chatcompletion.ErrEditCancelled)
+	})
+	t.Run("message", func(t *testing.T) {
+		tester(t, "\nexplain\n\nthis  \n"+strings.TrimLeft(template, "\n"), "explain\n\nthis", nil)
+	})
+	t.Run("below scissors ignored", func(t *testing.T) {
+		tester(t, template+"ignored\n", "", chatcompletion.ErrEditCancelled)
+	})
+	t.Run("without scissors", func(t *testing.T) {
+		tester(t, "explain", "explain", nil)
+	})
+}
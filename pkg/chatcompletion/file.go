@@ -0,0 +1,61 @@
+package chatcompletion
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// ReadMessagesFile reads an array of messages from a YAML or JSON file.
+func ReadMessagesFile(path string) ([]openai.ChatCompletionMessage, error) {
+	var messages []openai.ChatCompletionMessage
+	err := readFile(path, &messages)
+	if err != nil {
+		return nil, fmt.Errorf("read messages file: %w", err)
+	}
+	return messages, nil
+}
+
+// ReadRequestFile reads a complete request from a YAML or JSON file.
+func ReadRequestFile(path string) (openai.ChatCompletionRequest, error) {
+	var req openai.ChatCompletionRequest
+	err := readFile(path, &req)
+	if err != nil {
+		return req, fmt.Errorf("read request file: %w", err)
+	}
+	return req, nil
+}
+
+// readFile unmarshals a YAML or JSON file into v. The openai types only have
+// json tags so YAML is converted to JSON first.
+func readFile(path string, v any) error {
+	//nolint: gosec // the intent is to read a file from a user supplied location
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		var doc any
+		err = yaml.Unmarshal(data, &doc)
+		if err != nil {
+			return fmt.Errorf("unmarshal yaml %s: %w", path, err)
+		}
+
+		data, err = json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("convert yaml %s: %w", path, err)
+		}
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+	return nil
+}
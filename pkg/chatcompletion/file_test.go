@@ -0,0 +1,78 @@
+package chatcompletion_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMessagesFile(t *testing.T) {
+	expected := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "translate to french"},
+		{Role: openai.ChatMessageRoleUser, Content: "hello"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "bonjour"},
+	}
+
+	tester := func(t *testing.T, name string, content string) {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		messages, err := chatcompletion.ReadMessagesFile(path)
+		require.NoError(t, err)
+		require.Equal(t, expected, messages)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		tester(t, "messages.json", `[
+  {"role": "system", "content": "translate to french"},
+  {"role": "user", "content": "hello"},
+  {"role": "assistant", "content": "bonjour"}
+]`)
+	})
+	t.Run("yaml", func(t *testing.T) {
+		tester(t, "messages.yaml", `
+- role: system
+  content: translate to french
+- role: user
+  content: hello
+- role: assistant
+  content: bonjour
+`)
+	})
+	t.Run("json as yaml", func(t *testing.T) {
+		tester(t, "messages", `[{"role": "system", "content": "translate to french"}, {"role": "user", "content": "hello"}, {"role": "assistant", "content": "bonjour"}]`)
+	})
+}
+
+func TestReadRequestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "request.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+model: gpt-4o
+temperature: 0.5
+max_completion_tokens: 100
+messages:
+- role: user
+  content: hello
+`), 0o600))
+
+	req, err := chatcompletion.ReadRequestFile(path)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		openai.ChatCompletionRequest{
+			Model:               "gpt-4o",
+			Temperature:         0.5,
+			MaxCompletionTokens: 100,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "hello"},
+			},
+		},
+		req)
+
+	_, err = chatcompletion.ReadRequestFile(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
@@ -0,0 +1,232 @@
+package chatcompletion
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	ansiGreen  = "\x1b[32m"
+	ansiRed    = "\x1b[31m"
+	ansiReset  = "\x1b[0m"
+	ansiYellow = "\x1b[33m"
+)
+
+var _ ResponseWriter = &LogProbsResponseWriter{}
+
+// LogProbsResponseWriter writes the content of the response with each token
+// colored by its probability: green when at least 90%, yellow when at least
+// 50%, and red otherwise. If Table is set, a table of the top alternatives at
+// each token position is written after the content of each choice.
+type LogProbsResponseWriter struct {
+	NoColor bool
+	Table   bool
+	W       io.Writer
+
+	choiceStarted bool
+	demux         streamDemultiplexer
+	labelChoices  bool
+	tokens        []tokenLogProb
+}
+
+type tokenLogProb struct {
+	logprob float64
+	token   string
+	top     []tokenLogProb
+}
+
+func (b *LogProbsResponseWriter) FlushStream() error {
+	err := b.demux.Flush(b.writeChoiceStream)
+	if err != nil {
+		return fmt.Errorf("logprobsresponsewriter flushstream: %w", err)
+	}
+	return nil
+}
+
+func (b *LogProbsResponseWriter) Write(res openai.ChatCompletionResponse) error {
+	for _, choice := range res.Choices {
+		if len(res.Choices) > 1 {
+			err := writeChoiceHeader(b.W, choice.Index)
+			if err != nil {
+				return fmt.Errorf("logprobsresponsewriter write: %w", err)
+			}
+		}
+
+		var tokens []tokenLogProb
+		if choice.LogProbs == nil {
+			_, err := fmt.Fprint(b.W, choice.Message.Content)
+			if err != nil {
+				return fmt.Errorf("logprobsresponsewriter write: %w", err)
+			}
+		} else {
+			tokens = make([]tokenLogProb, 0, len(choice.LogProbs.Content))
+			for _, lp := range choice.LogProbs.Content {
+				token := tokenLogProb{token: lp.Token, logprob: lp.LogProb}
+				for _, top := range lp.TopLogProbs {
+					token.top = append(token.top, tokenLogProb{token: top.Token, logprob: top.LogProb})
+				}
+				tokens = append(tokens, token)
+			}
+
+			err := b.writeTokens(tokens)
+			if err != nil {
+				return fmt.Errorf("logprobsresponsewriter write: %w", err)
+			}
+		}
+
+		err := b.writeChoiceEnd(tokens)
+		if err != nil {
+			return fmt.Errorf("logprobsresponsewriter write: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *LogProbsResponseWriter) WriteRequest(req openai.ChatCompletionRequest) error {
+	b.labelChoices = req.N > 1
+	return nil
+}
+
+func (b *LogProbsResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
+	err := b.demux.Write(res, b.writeChoiceStream)
+	if err != nil {
+		return fmt.Errorf("logprobsresponsewriter writestream: %w", err)
+	}
+	return nil
+}
+
+func (b *LogProbsResponseWriter) color(logprob float64) string {
+	if b.NoColor {
+		return ""
+	}
+
+	p := math.Exp(logprob)
+	switch {
+	case p >= 0.9:
+		return ansiGreen
+	case p >= 0.5:
+		return ansiYellow
+	default:
+		return ansiRed
+	}
+}
+
+func (b *LogProbsResponseWriter) writeChoiceEnd(tokens []tokenLogProb) error {
+	_, err := fmt.Fprintln(b.W)
+	if err != nil {
+		return fmt.Errorf("choice end: %w", err)
+	}
+
+	if b.Table && len(tokens) > 0 {
+		err := b.writeTable(tokens)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *LogProbsResponseWriter) writeChoiceStream(res openai.ChatCompletionStreamResponse) error {
+	for _, choice := range res.Choices {
+		if b.labelChoices && !b.choiceStarted {
+			err := writeChoiceHeader(b.W, choice.Index)
+			if err != nil {
+				return err
+			}
+		}
+		b.choiceStarted = true
+
+		if choice.Logprobs == nil || len(choice.Logprobs.Content) == 0 {
+			_, err := fmt.Fprint(b.W, choice.Delta.Content)
+			if err != nil {
+				return fmt.Errorf("content: %w", err)
+			}
+		} else {
+			tokens := make([]tokenLogProb, 0, len(choice.Logprobs.Content))
+			for _, lp := range choice.Logprobs.Content {
+				token := tokenLogProb{token: lp.Token, logprob: lp.Logprob}
+				for _, top := range lp.TopLogprobs {
+					token.top = append(token.top, tokenLogProb{token: top.Token, logprob: top.Logprob})
+				}
+				tokens = append(tokens, token)
+			}
+
+			err := b.writeTokens(tokens)
+			if err != nil {
+				return err
+			}
+			b.tokens = append(b.tokens, tokens...)
+		}
+
+		if isFinished(choice.FinishReason) {
+			err := b.writeChoiceEnd(b.tokens)
+			if err != nil {
+				return err
+			}
+			b.choiceStarted = false
+			b.tokens = nil
+		}
+	}
+	return nil
+}
+
+func (b *LogProbsResponseWriter) writeTable(tokens []tokenLogProb) error {
+	tw := tabwriter.NewWriter(b.W, 0, 0, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(tw, "#\ttoken\tprob\ttop alternatives")
+	if err != nil {
+		return fmt.Errorf("table header: %w", err)
+	}
+
+	for i, token := range tokens {
+		alternatives := make([]string, 0, len(token.top))
+		for _, top := range token.top {
+			alternatives = append(
+				alternatives,
+				fmt.Sprintf("%q %s", top.token, formatProbability(top.logprob)))
+		}
+
+		_, err := fmt.Fprintf(
+			tw,
+			"%d\t%q\t%s\t%s\n",
+			i,
+			token.token,
+			formatProbability(token.logprob),
+			strings.Join(alternatives, ", "))
+		if err != nil {
+			return fmt.Errorf("table row: %w", err)
+		}
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return fmt.Errorf("table flush: %w", err)
+	}
+	return nil
+}
+
+func (b *LogProbsResponseWriter) writeTokens(tokens []tokenLogProb) error {
+	for _, token := range tokens {
+		color := b.color(token.logprob)
+		reset := ansiReset
+		if color == "" {
+			reset = ""
+		}
+
+		_, err := fmt.Fprintf(b.W, "%s%s%s", color, token.token, reset)
+		if err != nil {
+			return fmt.Errorf("token: %w", err)
+		}
+	}
+	return nil
+}
+
+func formatProbability(logprob float64) string {
+	return fmt.Sprintf("%.2f%%", math.Exp(logprob)*100)
+}
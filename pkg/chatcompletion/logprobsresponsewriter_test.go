@@ -0,0 +1,116 @@
+package chatcompletion_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogProbsResponseWriter(t *testing.T) {
+	tester := func(
+		t *testing.T,
+		w *chatcompletion.LogProbsResponseWriter,
+		res *openai.ChatCompletionResponse,
+		sres []openai.ChatCompletionStreamResponse,
+		expected string,
+	) {
+		var buf strings.Builder
+		w.W = &buf
+
+		if res != nil {
+			require.NoError(t, w.Write(*res))
+		}
+		for _, r := range sres {
+			require.NoError(t, w.WriteStream(r))
+		}
+
+		require.Equal(t, expected, buf.String())
+	}
+
+	res := &openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{Content: "Hi there"},
+				LogProbs: &openai.LogProbs{
+					Content: []openai.LogProb{
+						{
+							Token:   "Hi",
+							LogProb: math.Log(0.95),
+							TopLogProbs: []openai.TopLogProbs{
+								{Token: "Hi", LogProb: math.Log(0.95)},
+								{Token: "Hello", LogProb: math.Log(0.04)},
+							},
+						},
+						{
+							Token:   " there",
+							LogProb: math.Log(0.25),
+							TopLogProbs: []openai.TopLogProbs{
+								{Token: "!", LogProb: math.Log(0.5)},
+								{Token: " there", LogProb: math.Log(0.25)},
+							},
+						},
+					},
+				},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+	}
+
+	t.Run("buffered color", func(t *testing.T) {
+		tester(
+			t,
+			&chatcompletion.LogProbsResponseWriter{},
+			res,
+			nil,
+			"\x1b[32mHi\x1b[0m\x1b[31m there\x1b[0m\n")
+	})
+
+	t.Run("buffered table", func(t *testing.T) {
+		tester(
+			t,
+			&chatcompletion.LogProbsResponseWriter{NoColor: true, Table: true},
+			res,
+			nil,
+			""+
+				"Hi there\n"+
+				"#  token     prob    top alternatives\n"+
+				"0  \"Hi\"      95.00%  \"Hi\" 95.00%, \"Hello\" 4.00%\n"+
+				"1  \" there\"  25.00%  \"!\" 50.00%, \" there\" 25.00%\n")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		chunk := func(token string, p float64, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+			choice := openai.ChatCompletionStreamChoice{
+				Delta:        openai.ChatCompletionStreamChoiceDelta{Content: token},
+				FinishReason: finishReason,
+			}
+			if token != "" {
+				choice.Logprobs = &openai.ChatCompletionStreamChoiceLogprobs{
+					Content: []openai.ChatCompletionTokenLogprob{{Token: token, Logprob: math.Log(p)}},
+				}
+			}
+			return openai.ChatCompletionStreamResponse{
+				Choices: []openai.ChatCompletionStreamChoice{choice},
+			}
+		}
+
+		tester(
+			t,
+			&chatcompletion.LogProbsResponseWriter{NoColor: true, Table: true},
+			nil,
+			[]openai.ChatCompletionStreamResponse{
+				chunk("Hi", 0.95, ""),
+				chunk(" there", 0.6, ""),
+				chunk("", 0, openai.FinishReasonStop),
+			},
+			""+
+				"Hi there\n"+
+				"#  token     prob    top alternatives\n"+
+				"0  \"Hi\"      95.00%  \n"+
+				"1  \" there\"  60.00%  \n")
+	})
+}
@@ -0,0 +1,227 @@
+package chatcompletion
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	ReasoningHide   ReasoningMode = "hide"
+	ReasoningShow   ReasoningMode = "show"
+	ReasoningStderr ReasoningMode = "stderr"
+
+	thinkEndTag   = "</think>"
+	thinkStartTag = "<think>"
+)
+
+var _ ResponseWriter = &ReasoningResponseWriter{}
+
+// ReasoningMode determines what is done with the reasoning (thinking) of a
+// response.
+type ReasoningMode string
+
+// ReasoningResponseWriter separates reasoning from the content of responses
+// before passing them thru to the wrapped writer. Reasoning is either sent as
+// a reasoning_content field or embedded in the content as a <think> block
+// (ollama and others), after separation it is always in the ReasoningContent
+// field. Depending on the mode, the reasoning is then left for the wrapped
+// writer to show, removed, or written to Stderr and removed.
+type ReasoningResponseWriter struct {
+	Mode   ReasoningMode
+	Stderr io.Writer
+
+	splitters     map[int]*reasoningSplitter
+	stderrStarted bool
+	w             ResponseWriter
+}
+
+// reasoningSplitter separates <think> blocks from content that may arrive in
+// arbitrarily split chunks, holding back any partial tag until the next chunk
+// shows whether it is a tag.
+type reasoningSplitter struct {
+	inThink  bool
+	pending  string
+	trimNext bool
+}
+
+func (b *ReasoningResponseWriter) FlushStream() error {
+	return flushStream(b.w)
+}
+
+func (b *ReasoningResponseWriter) Write(res openai.ChatCompletionResponse) error {
+	// copy so the callers response is not modified
+	res.Choices = append([]openai.ChatCompletionChoice(nil), res.Choices...)
+	for i := range res.Choices {
+		message := &res.Choices[i].Message
+
+		var splitter reasoningSplitter
+		reasoning, content := splitter.Split(message.Content)
+		flushedReasoning, flushedContent := splitter.Flush()
+		message.ReasoningContent += reasoning + flushedReasoning
+		message.Content = content + flushedContent
+
+		err := b.applyMode(&message.ReasoningContent, true)
+		if err != nil {
+			return fmt.Errorf("reasoningresponsewriter write: %w", err)
+		}
+	}
+
+	err := b.w.Write(res)
+	if err != nil {
+		return fmt.Errorf("pass-thru write: %w", err)
+	}
+	return nil
+}
+
+func (b *ReasoningResponseWriter) WriteRequest(req openai.ChatCompletionRequest) error {
+	b.splitters = nil
+	err := b.w.WriteRequest(req)
+	if err != nil {
+		return fmt.Errorf("pass-thru write request: %w", err)
+	}
+	return nil
+}
+
+func (b *ReasoningResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
+	res.Choices = append([]openai.ChatCompletionStreamChoice(nil), res.Choices...)
+	for i := range res.Choices {
+		choice := &res.Choices[i]
+
+		if b.splitters == nil {
+			b.splitters = map[int]*reasoningSplitter{}
+		}
+		splitter, ok := b.splitters[choice.Index]
+		if !ok {
+			splitter = &reasoningSplitter{}
+			b.splitters[choice.Index] = splitter
+		}
+
+		reasoning, content := splitter.Split(choice.Delta.Content)
+		finished := isFinished(choice.FinishReason)
+		if finished {
+			flushedReasoning, flushedContent := splitter.Flush()
+			reasoning += flushedReasoning
+			content += flushedContent
+			delete(b.splitters, choice.Index)
+		}
+		choice.Delta.ReasoningContent += reasoning
+		choice.Delta.Content = content
+
+		err := b.applyMode(&choice.Delta.ReasoningContent, content != "" || finished)
+		if err != nil {
+			return fmt.Errorf("reasoningresponsewriter writestream: %w", err)
+		}
+	}
+
+	err := b.w.WriteStream(res)
+	if err != nil {
+		return fmt.Errorf("pass-thru write stream: %w", err)
+	}
+	return nil
+}
+
+// applyMode handles the reasoning according to the mode. ended indicates that
+// no more reasoning will follow for the current choice.
+func (b *ReasoningResponseWriter) applyMode(reasoning *string, ended bool) error {
+	switch b.Mode {
+	case ReasoningShow:
+		return nil
+	case ReasoningStderr:
+		if *reasoning != "" {
+			_, err := io.WriteString(b.Stderr, *reasoning)
+			if err != nil {
+				return fmt.Errorf("stderr: %w", err)
+			}
+			b.stderrStarted = true
+		}
+		if ended && b.stderrStarted {
+			_, err := io.WriteString(b.Stderr, "\n")
+			if err != nil {
+				return fmt.Errorf("stderr: %w", err)
+			}
+			b.stderrStarted = false
+		}
+	case ReasoningHide:
+	}
+
+	*reasoning = ""
+	return nil
+}
+
+func NewReasoningResponseWriter(
+	w ResponseWriter,
+	mode ReasoningMode,
+	stderr io.Writer,
+) *ReasoningResponseWriter {
+	return &ReasoningResponseWriter{Mode: mode, Stderr: stderr, w: w}
+}
+
+// Flush returns anything held back waiting for more text.
+func (s *reasoningSplitter) Flush() (string, string) {
+	pending := s.pending
+	s.pending = ""
+	if s.inThink {
+		return pending, ""
+	}
+	return "", pending
+}
+
+// Split returns the reasoning and content found in text.
+func (s *reasoningSplitter) Split(text string) (string, string) {
+	var reasoning strings.Builder
+	var content strings.Builder
+
+	text = s.pending + text
+	s.pending = ""
+	for text != "" {
+		tag := thinkStartTag
+		if s.inThink {
+			tag = thinkEndTag
+		}
+
+		var part string
+		i := strings.Index(text, tag)
+		if i >= 0 {
+			part = text[:i]
+			text = text[i+len(tag):]
+		} else {
+			held := partialSuffix(text, tag)
+			part = text[:len(text)-held]
+			s.pending = text[len(text)-held:]
+			text = ""
+		}
+
+		if s.inThink {
+			reasoning.WriteString(part)
+		} else {
+			if s.trimNext {
+				part = strings.TrimLeft(part, "\r\n")
+				s.trimNext = part == "" && i < 0
+			}
+			content.WriteString(part)
+		}
+
+		if i >= 0 {
+			s.inThink = !s.inThink
+			// models separate the answer from the reasoning with blank lines
+			// that are not part of the answer
+			s.trimNext = !s.inThink
+		}
+	}
+
+	return reasoning.String(), content.String()
+}
+
+// partialSuffix returns the length of the longest suffix of text that is a
+// prefix of tag.
+func partialSuffix(text string, tag string) int {
+	for n := min(len(tag)-1, len(text)); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
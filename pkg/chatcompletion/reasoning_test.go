@@ -0,0 +1,130 @@
+package chatcompletion_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasoningResponseWriter(t *testing.T) {
+	chunk := func(content string, reasoning string, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{
+				{
+					Delta: openai.ChatCompletionStreamChoiceDelta{
+						Content:          content,
+						ReasoningContent: reasoning,
+					},
+					FinishReason: finishReason,
+				},
+			},
+		}
+	}
+
+	// think tags split at awkward places the way tokens arrive
+	thinkTagStream := []openai.ChatCompletionStreamResponse{
+		chunk("<th", "", ""),
+		chunk("ink>\nthe user", "", ""),
+		chunk(" wants a color</", "", ""),
+		chunk("think>\n\n", "", ""),
+		chunk("\nblue", "", ""),
+		chunk(" <b>", "", ""),
+		chunk("", "", openai.FinishReasonStop),
+	}
+	reasoningContentStream := []openai.ChatCompletionStreamResponse{
+		chunk("", "\nthe user", ""),
+		chunk("", " wants a color", ""),
+		chunk("blue", "", ""),
+		chunk(" <b>", "", ""),
+		chunk("", "", openai.FinishReasonStop),
+	}
+
+	tester := func(
+		t *testing.T,
+		mode chatcompletion.ReasoningMode,
+		res *openai.ChatCompletionResponse,
+		sres []openai.ChatCompletionStreamResponse,
+		expectedStdout string,
+		expectedStderr string,
+	) {
+		var stdout strings.Builder
+		var stderr strings.Builder
+		buf := chatcompletion.NewResponseWriterContentBuffer(
+			chatcompletion.NewReasoningResponseWriter(
+				&chatcompletion.ContentResponseWriter{W: &stdout},
+				mode,
+				&stderr))
+
+		if res != nil {
+			require.NoError(t, buf.Write(*res))
+		}
+		for _, r := range sres {
+			require.NoError(t, buf.WriteStream(r))
+		}
+
+		require.Equal(t, expectedStdout, stdout.String())
+		require.Equal(t, expectedStderr, stderr.String())
+		require.Equal(t, "blue <b>", buf.String())
+		require.Equal(t, "\nthe user wants a color", buf.Reasoning())
+	}
+
+	t.Run("think tags show", func(t *testing.T) {
+		tester(
+			t,
+			chatcompletion.ReasoningShow,
+			nil,
+			thinkTagStream,
+			"<think>\nthe user wants a color</think>\n\nblue <b>",
+			"")
+	})
+
+	t.Run("think tags hide", func(t *testing.T) {
+		tester(t, chatcompletion.ReasoningHide, nil, thinkTagStream, "blue <b>", "")
+	})
+
+	t.Run("think tags stderr", func(t *testing.T) {
+		tester(
+			t,
+			chatcompletion.ReasoningStderr,
+			nil,
+			thinkTagStream,
+			"blue <b>",
+			"\nthe user wants a color\n")
+	})
+
+	t.Run("reasoning content show", func(t *testing.T) {
+		tester(
+			t,
+			chatcompletion.ReasoningShow,
+			nil,
+			reasoningContentStream,
+			"<think>\nthe user wants a color</think>\n\nblue <b>",
+			"")
+	})
+
+	t.Run("reasoning content hide", func(t *testing.T) {
+		tester(t, chatcompletion.ReasoningHide, nil, reasoningContentStream, "blue <b>", "")
+	})
+
+	t.Run("buffered hide", func(t *testing.T) {
+		tester(
+			t,
+			chatcompletion.ReasoningHide,
+			&openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Message: openai.ChatCompletionMessage{
+							Content: "<think>\nthe user wants a color</think>\n\nblue <b>",
+						},
+						FinishReason: openai.FinishReasonStop,
+					},
+				},
+			},
+			nil,
+			"blue <b>",
+			"")
+	})
+}
@@ -2,7 +2,6 @@ package chatcompletion
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -12,8 +11,15 @@ import (
 
 var _ ResponseWriter = &ContentResponseWriter{}
 
+// ContentResponseWriter writes only the content of the response. When
+// multiple choices are requested, each is preceded by a header identifying the
+// choice.
 type ContentResponseWriter struct {
-	W io.Writer
+	W             io.Writer
+	choiceStarted bool
+	demux         streamDemultiplexer
+	inReasoning   bool
+	labelChoices  bool
 }
 
 type ResponseWriter interface {
@@ -22,13 +28,40 @@ type ResponseWriter interface {
 	WriteStream(openai.ChatCompletionStreamResponse) error
 }
 
+// RawResponseWriter writes the responses as JSON. Each choice is already
+// labeled by its index, but stream chunks are reordered so that all of the
+// chunks for a choice are written before the next choice.
 type RawResponseWriter struct {
-	W io.Writer
+	W     io.Writer
+	demux streamDemultiplexer
 }
 
+// RecapResponseWriter writes a transcript of the conversation including the
+// request messages, the tool calls made and their results, and a footer with
+// the finish reason and usage for each response.
 type RecapResponseWriter struct {
-	streamWriteCount int
-	W                io.Writer
+	W               io.Writer
+	demux           streamDemultiplexer
+	labelChoices    bool
+	messagesWritten int
+	stream          *recapStream
+}
+
+type recapStream struct {
+	index       int
+	inReasoning bool
+	refusal     strings.Builder
+	role        string
+	started     bool
+	toolCalls   []openai.ToolCall
+}
+
+func (b *ContentResponseWriter) FlushStream() error {
+	err := b.demux.Flush(b.writeChoiceStream)
+	if err != nil {
+		return fmt.Errorf("contentresponsewriter flushstream: %w", err)
+	}
+	return nil
 }
 
 func (b *ContentResponseWriter) Write(res openai.ChatCompletionResponse) error {
@@ -36,25 +69,102 @@ func (b *ContentResponseWriter) Write(res openai.ChatCompletionResponse) error {
 		return nil
 	}
 
-	_, err := b.W.Write([]byte(res.Choices[0].Message.Content))
-	if err != nil {
-		return fmt.Errorf("contentresponsewriter write: %w", err)
+	if len(res.Choices) == 1 {
+		_, err := fmt.Fprintf(
+			b.W,
+			"%s%s",
+			formatReasoning(res.Choices[0].Message.ReasoningContent),
+			res.Choices[0].Message.Content)
+		if err != nil {
+			return fmt.Errorf("contentresponsewriter write: %w", err)
+		}
+		return nil
+	}
+
+	for _, choice := range res.Choices {
+		err := writeChoiceHeader(b.W, choice.Index)
+		if err != nil {
+			return fmt.Errorf("contentresponsewriter write: %w", err)
+		}
+
+		_, err = fmt.Fprintf(
+			b.W,
+			"%s%s\n\n",
+			formatReasoning(choice.Message.ReasoningContent),
+			choice.Message.Content)
+		if err != nil {
+			return fmt.Errorf("contentresponsewriter write: %w", err)
+		}
 	}
 	return nil
 }
 
-func (b *ContentResponseWriter) WriteRequest(_ openai.ChatCompletionRequest) error {
+func (b *ContentResponseWriter) WriteRequest(req openai.ChatCompletionRequest) error {
+	b.labelChoices = req.N > 1
 	return nil
 }
 
 func (b *ContentResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
-	if len(res.Choices) < 1 {
-		return nil
+	err := b.demux.Write(res, b.writeChoiceStream)
+	if err != nil {
+		return fmt.Errorf("contentresponsewriter writestream: %w", err)
 	}
+	return nil
+}
 
-	_, err := b.W.Write([]byte(res.Choices[0].Delta.Content))
+func (b *ContentResponseWriter) writeChoiceStream(res openai.ChatCompletionStreamResponse) error {
+	for _, choice := range res.Choices {
+		if b.labelChoices && !b.choiceStarted {
+			err := writeChoiceHeader(b.W, choice.Index)
+			if err != nil {
+				return err
+			}
+			b.choiceStarted = true
+		}
+
+		if choice.Delta.ReasoningContent != "" {
+			if !b.inReasoning {
+				_, err := fmt.Fprint(b.W, thinkStartTag)
+				if err != nil {
+					return fmt.Errorf("reasoning start: %w", err)
+				}
+				b.inReasoning = true
+			}
+
+			_, err := fmt.Fprint(b.W, choice.Delta.ReasoningContent)
+			if err != nil {
+				return fmt.Errorf("reasoning: %w", err)
+			}
+		}
+
+		if b.inReasoning && (choice.Delta.Content != "" || isFinished(choice.FinishReason)) {
+			_, err := fmt.Fprint(b.W, thinkEndTag+"\n\n")
+			if err != nil {
+				return fmt.Errorf("reasoning end: %w", err)
+			}
+			b.inReasoning = false
+		}
+
+		_, err := b.W.Write([]byte(choice.Delta.Content))
+		if err != nil {
+			return fmt.Errorf("content: %w", err)
+		}
+
+		if b.labelChoices && isFinished(choice.FinishReason) {
+			_, err := fmt.Fprint(b.W, "\n\n")
+			if err != nil {
+				return fmt.Errorf("content end: %w", err)
+			}
+			b.choiceStarted = false
+		}
+	}
+	return nil
+}
+
+func (b *RawResponseWriter) FlushStream() error {
+	err := b.demux.Flush(b.writeChunk)
 	if err != nil {
-		return fmt.Errorf("contentresponsewriter writestream: %w", err)
+		return fmt.Errorf("rawresponsewriter flushstream: %w", err)
 	}
 	return nil
 }
@@ -72,76 +182,399 @@ func (b *RawResponseWriter) WriteRequest(_ openai.ChatCompletionRequest) error {
 }
 
 func (b *RawResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
-	err := json.NewEncoder(b.W).Encode(res)
+	err := b.demux.Write(res, b.writeChunk)
 	if err != nil {
 		return fmt.Errorf("rawresponsewriter writestream: %w", err)
 	}
 	return nil
 }
 
+func (b *RawResponseWriter) writeChunk(res openai.ChatCompletionStreamResponse) error {
+	err := json.NewEncoder(b.W).Encode(res)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return nil
+}
+
+func (b *RecapResponseWriter) FlushStream() error {
+	err := b.demux.Flush(b.writeChoiceStream)
+	if err != nil {
+		return fmt.Errorf("recapresponsewriter flushstream: %w", err)
+	}
+	return nil
+}
+
 func (b *RecapResponseWriter) Write(res openai.ChatCompletionResponse) error {
-	if len(res.Choices) < 1 {
-		return nil
+	for _, choice := range res.Choices {
+		label := choiceLabel(choice.Index, len(res.Choices) > 1)
+		err := b.writeMessage(choice.Message, label)
+		if err != nil {
+			return fmt.Errorf("recapresponsewriter write: %w", err)
+		}
+
+		err = b.writeFinishReason(choice.FinishReason, label)
+		if err != nil {
+			return fmt.Errorf("recapresponsewriter write: %w", err)
+		}
 	}
 
-	_, err := fmt.Fprintf(
-		b.W,
-		"%s: %s\n\n",
-		res.Choices[0].Message.Role,
-		res.Choices[0].Message.Content)
+	if len(res.Choices) > 0 {
+		// the response message becomes part of the next request when tool
+		// calls are made, so it is counted as written to avoid repeating it
+		b.messagesWritten++
+	}
+
+	err := b.writeUsage(res.Usage)
 	if err != nil {
-		return fmt.Errorf("contentresponsewriter write: %w", err)
+		return fmt.Errorf("recapresponsewriter write: %w", err)
 	}
 	return nil
 }
 
 func (b *RecapResponseWriter) WriteRequest(req openai.ChatCompletionRequest) error {
-	var err error
-	for _, message := range req.Messages {
-		switch message.Role {
-		case openai.ChatMessageRoleAssistant,
-			openai.ChatMessageRoleSystem,
-			openai.ChatMessageRoleUser:
-			_, ierr := fmt.Fprintf(b.W, "%s: %s\n\n", message.Role, message.Content)
-			err = errors.Join(ierr)
+	// tool call handling sends a follow up request containing all of the
+	// previous messages, only the new ones belong in the transcript
+	start := b.messagesWritten
+	if start > len(req.Messages) {
+		start = 0
+	}
+
+	for _, message := range req.Messages[start:] {
+		err := b.writeMessage(message, "")
+		if err != nil {
+			return fmt.Errorf("recapresponsewriter write request: %w", err)
 		}
 	}
+	b.messagesWritten = len(req.Messages)
+	b.labelChoices = req.N > 1
+	b.stream = nil
+	return nil
+}
+
+func (b *RecapResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
+	err := b.demux.Write(res, b.writeChoiceStream)
 	if err != nil {
-		return fmt.Errorf("contentresponsewriter write request: %w", err)
+		return fmt.Errorf("recapresponsewriter writestream: %w", err)
 	}
 	return nil
 }
 
-func (b *RecapResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
-	if len(res.Choices) < 1 {
+func (b *RecapResponseWriter) writeChoiceStream(res openai.ChatCompletionStreamResponse) error {
+	for _, choice := range res.Choices {
+		if b.stream == nil {
+			b.stream = &recapStream{
+				index: choice.Index,
+				role:  openai.ChatMessageRoleAssistant,
+			}
+		}
+
+		if choice.Delta.Role != "" {
+			b.stream.role = choice.Delta.Role
+		}
+
+		if choice.Delta.ReasoningContent != "" {
+			if !b.stream.inReasoning {
+				_, err := fmt.Fprintf(b.W, "%s%s reasoning: ", b.stream.role, b.streamLabel())
+				if err != nil {
+					return fmt.Errorf("reasoning start: %w", err)
+				}
+				b.stream.inReasoning = true
+			}
+
+			_, err := fmt.Fprint(b.W, choice.Delta.ReasoningContent)
+			if err != nil {
+				return fmt.Errorf("reasoning: %w", err)
+			}
+		}
+
+		if b.stream.inReasoning && (choice.Delta.Content != "" || isFinished(choice.FinishReason)) {
+			_, err := fmt.Fprint(b.W, "\n\n")
+			if err != nil {
+				return fmt.Errorf("reasoning end: %w", err)
+			}
+			b.stream.inReasoning = false
+		}
+
+		if !b.stream.started && choice.Delta.Content != "" {
+			_, err := fmt.Fprintf(b.W, "%s%s: ", b.stream.role, b.streamLabel())
+			if err != nil {
+				return fmt.Errorf("start: %w", err)
+			}
+			b.stream.started = true
+		}
+
+		_, err := fmt.Fprint(b.W, choice.Delta.Content)
+		if err != nil {
+			return fmt.Errorf("content: %w", err)
+		}
+
+		b.stream.refusal.WriteString(choice.Delta.Refusal)
+		b.stream.toolCalls, err = mergeToolCallDeltas(b.stream.toolCalls, choice.Delta.ToolCalls)
+		if err != nil {
+			return err
+		}
+
+		if isFinished(choice.FinishReason) {
+			err := b.writeStreamEnd(choice.FinishReason)
+			if err != nil {
+				return fmt.Errorf("end: %w", err)
+			}
+		}
+	}
+
+	if res.Usage != nil {
+		err := b.writeUsage(*res.Usage)
+		if err != nil {
+			return fmt.Errorf("usage: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *RecapResponseWriter) streamLabel() string {
+	return choiceLabel(b.stream.index, b.labelChoices)
+}
+
+func (b *RecapResponseWriter) writeFinishReason(reason openai.FinishReason, label string) error {
+	if !isFinished(reason) {
 		return nil
 	}
 
-	if b.streamWriteCount == 0 {
-		_, err := fmt.Fprintf(b.W, "%s: ", res.Choices[0].Delta.Role)
+	_, err := fmt.Fprintf(b.W, "finish_reason%s: %s\n", label, reason)
+	if err != nil {
+		return fmt.Errorf("finish reason: %w", err)
+	}
+	return nil
+}
+
+func (b *RecapResponseWriter) writeMessage(message openai.ChatCompletionMessage, label string) error {
+	role := message.Role + label
+	content := messageText(message)
+
+	if message.ReasoningContent != "" {
+		_, err := fmt.Fprintf(b.W, "%s reasoning: %s\n\n", role, message.ReasoningContent)
 		if err != nil {
-			return fmt.Errorf("recapresponsewriter writestream start: %w", err)
+			return fmt.Errorf("message reasoning: %w", err)
 		}
 	}
 
-	_, err := fmt.Fprint(b.W, res.Choices[0].Delta.Role)
+	var err error
+	switch {
+	case message.Role == openai.ChatMessageRoleTool:
+		_, err = fmt.Fprintf(
+			b.W,
+			"%s (%s %s): %s\n\n",
+			role,
+			message.Name,
+			message.ToolCallID,
+			content)
+	case content != "" ||
+		(len(message.ToolCalls) == 0 && message.Refusal == "" && message.ReasoningContent == ""):
+		_, err = fmt.Fprintf(b.W, "%s: %s\n\n", role, content)
+	}
 	if err != nil {
-		return fmt.Errorf("recapresponsewriter writestream: %w", err)
+		return fmt.Errorf("message: %w", err)
+	}
+
+	if message.Refusal != "" {
+		_, err = fmt.Fprintf(b.W, "%s refusal: %s\n\n", role, message.Refusal)
+		if err != nil {
+			return fmt.Errorf("message refusal: %w", err)
+		}
+	}
+
+	err = b.writeToolCalls(role, message.ToolCalls)
+	if err != nil {
+		return fmt.Errorf("message: %w", err)
 	}
 
-	if res.Choices[0].FinishReason != openai.FinishReasonNull {
-		_, err := fmt.Fprintf(b.W, "%s: ", res.Choices[0].Delta.Role)
+	return nil
+}
+
+func (b *RecapResponseWriter) writeStreamEnd(reason openai.FinishReason) error {
+	if b.stream.started {
+		_, err := fmt.Fprint(b.W, "\n\n")
 		if err != nil {
-			return fmt.Errorf("recapresponsewriter writestream end: %w", err)
+			return fmt.Errorf("content end: %w", err)
 		}
 	}
 
+	if b.stream.refusal.Len() > 0 {
+		_, err := fmt.Fprintf(
+			b.W,
+			"%s%s refusal: %s\n\n",
+			b.stream.role,
+			b.streamLabel(),
+			b.stream.refusal.String())
+		if err != nil {
+			return fmt.Errorf("refusal: %w", err)
+		}
+	}
+
+	err := b.writeToolCalls(b.stream.role+b.streamLabel(), b.stream.toolCalls)
+	if err != nil {
+		return err
+	}
+
+	err = b.writeFinishReason(reason, b.streamLabel())
+	if err != nil {
+		return err
+	}
+
+	if b.stream.index == 0 {
+		// only the first choice is carried into tool call requests
+		b.messagesWritten++
+	}
+	b.stream = nil
+	return nil
+}
+
+func (b *RecapResponseWriter) writeToolCalls(role string, toolCalls []openai.ToolCall) error {
+	for _, toolCall := range toolCalls {
+		_, err := fmt.Fprintf(
+			b.W,
+			"%s tool call (%s): %s(%s)\n\n",
+			role,
+			toolCall.ID,
+			toolCall.Function.Name,
+			toolCall.Function.Arguments)
+		if err != nil {
+			return fmt.Errorf("tool call: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *RecapResponseWriter) writeUsage(usage openai.Usage) error {
+	if usage.TotalTokens == 0 && usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(
+		b.W,
+		"usage: prompt_tokens=%d completion_tokens=%d total_tokens=%d\n",
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.TotalTokens)
+	if err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
 	return nil
 }
 
+// formatReasoning returns reasoning wrapped in think tags and separated from
+// the content that follows, or empty if there is no reasoning.
+func formatReasoning(reasoning string) string {
+	if reasoning == "" {
+		return ""
+	}
+	return thinkStartTag + reasoning + thinkEndTag + "\n\n"
+}
+
+// choiceLabel returns the suffix used to identify the choice at index when
+// multiple choices are being written.
+func choiceLabel(index int, enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return fmt.Sprintf(" (choice %d)", index)
+}
+
+// isFinished returns true if reason indicates the choice is complete. Servers
+// send null while generating which decodes to an empty reason.
+func isFinished(reason openai.FinishReason) bool {
+	return reason != "" && reason != openai.FinishReasonNull
+}
+
+// mergeToolCallDeltas appends the streamed tool call fragments in deltas to
+// toolCalls. Streamed tool calls arrive as an initial fragment containing the
+// id and function name followed by fragments of the arguments, all of which
+// share the same index. Indexes arrive in order so an index may refer to an
+// existing tool call or start the next one. A fragment without an index
+// continues the last tool call unless it carries a new id.
+func mergeToolCallDeltas(toolCalls []openai.ToolCall, deltas []openai.ToolCall) ([]openai.ToolCall, error) {
+	for _, delta := range deltas {
+		var index int
+		switch {
+		case delta.Index != nil:
+			index = *delta.Index
+		case len(toolCalls) == 0,
+			delta.ID != "" && delta.ID != toolCalls[len(toolCalls)-1].ID:
+			index = len(toolCalls)
+		default:
+			index = len(toolCalls) - 1
+		}
+		if index < 0 {
+			return toolCalls, fmt.Errorf("tool call index %d is negative", index)
+		}
+		if index > len(toolCalls) {
+			return toolCalls, fmt.Errorf("tool call index %d is out of order, expected at most %d", index, len(toolCalls))
+		}
+
+		if index == len(toolCalls) {
+			toolCalls = append(toolCalls, openai.ToolCall{})
+		}
+
+		toolCall := &toolCalls[index]
+		if delta.ID != "" {
+			toolCall.ID = delta.ID
+		}
+		if delta.Type != "" {
+			toolCall.Type = delta.Type
+		}
+		if delta.Function.Name != "" {
+			toolCall.Function.Name = delta.Function.Name
+		}
+		toolCall.Function.Arguments += delta.Function.Arguments
+	}
+	return toolCalls, nil
+}
+
+// messageText returns the content of message with any image parts of a
+// multi-part message replaced by a placeholder. Data URLs are summarized by
+// their media type as they are far too large to be useful.
+func messageText(message openai.ChatCompletionMessage) string {
+	if len(message.MultiContent) == 0 {
+		return message.Content
+	}
+
+	parts := make([]string, 0, len(message.MultiContent))
+	for _, part := range message.MultiContent {
+		switch {
+		case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+			url := part.ImageURL.URL
+			if strings.HasPrefix(url, "data:") {
+				mediaType, _, _ := strings.Cut(strings.TrimPrefix(url, "data:"), ";")
+				url = "data:" + mediaType
+			}
+			parts = append(parts, fmt.Sprintf("[image: %s]", url))
+		default:
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ResponseWriterContentBuffer passes responses thru to the wrapped writer
+// while collecting the content of a single choice.
 type ResponseWriterContentBuffer struct {
-	w   ResponseWriter
-	buf strings.Builder
+	w         ResponseWriter
+	buf       strings.Builder
+	choice    int
+	reasoning strings.Builder
+	splitter  reasoningSplitter
+}
+
+func (b *ResponseWriterContentBuffer) FlushStream() error {
+	return flushStream(b.w)
+}
+
+// Reasoning returns the reasoning of the choice, which is never included in
+// String.
+func (b *ResponseWriterContentBuffer) Reasoning() string {
+	return b.reasoning.String()
 }
 
 func (b *ResponseWriterContentBuffer) String() string {
@@ -154,7 +587,12 @@ func (b *ResponseWriterContentBuffer) Write(res openai.ChatCompletionResponse) e
 		return fmt.Errorf("pass-thru write: %w", err)
 	}
 
-	_, _ = b.buf.Write([]byte(res.Choices[0].Message.Content))
+	for _, choice := range res.Choices {
+		if choice.Index == b.choice {
+			b.reasoning.WriteString(choice.Message.ReasoningContent)
+			b.writeContent(choice.Message.Content, true)
+		}
+	}
 	return nil
 }
 
@@ -172,10 +610,50 @@ func (b *ResponseWriterContentBuffer) WriteStream(res openai.ChatCompletionStrea
 		return fmt.Errorf("pass-thru write stream: %w", err)
 	}
 
-	_, _ = b.buf.Write([]byte(res.Choices[0].Delta.Content))
+	for _, choice := range res.Choices {
+		if choice.Index == b.choice {
+			b.reasoning.WriteString(choice.Delta.ReasoningContent)
+			b.writeContent(choice.Delta.Content, isFinished(choice.FinishReason))
+		}
+	}
 	return nil
 }
 
+// flushPending adds any content held back to look for reasoning tags, for
+// responses that end without finishing.
+func (b *ResponseWriterContentBuffer) flushPending() {
+	b.writeContent("", true)
+}
+
+func (b *ResponseWriterContentBuffer) writeContent(text string, finished bool) {
+	reasoning, content := b.splitter.Split(text)
+	b.reasoning.WriteString(reasoning)
+	b.buf.WriteString(content)
+
+	if finished {
+		reasoning, content := b.splitter.Flush()
+		b.reasoning.WriteString(reasoning)
+		b.buf.WriteString(content)
+	}
+}
+
 func NewResponseWriterContentBuffer(w ResponseWriter) *ResponseWriterContentBuffer {
 	return &ResponseWriterContentBuffer{w: w}
 }
+
+// NewResponseWriterContentBufferForChoice returns a buffer that collects the
+// content of the choice at index rather than the first choice.
+func NewResponseWriterContentBufferForChoice(
+	w ResponseWriter,
+	index int,
+) *ResponseWriterContentBuffer {
+	return &ResponseWriterContentBuffer{w: w, choice: index}
+}
+
+func writeChoiceHeader(w io.Writer, index int) error {
+	_, err := fmt.Fprintf(w, "--- choice %d ---\n", index)
+	if err != nil {
+		return fmt.Errorf("choice header: %w", err)
+	}
+	return nil
+}
@@ -62,6 +62,10 @@ func TestResponseWriter(t *testing.T) {
 		}
 	}
 
+	recapFac := func(w io.Writer) chatcompletion.ResponseWriter {
+		return &chatcompletion.RecapResponseWriter{W: w}
+	}
+
 	resFac := func(t *testing.T, raw string) (*openai.ChatCompletionResponse, string) {
 		var res openai.ChatCompletionResponse
 		err := json.Unmarshal([]byte(raw), &res)
@@ -110,6 +114,15 @@ func TestResponseWriter(t *testing.T) {
 				nil,
 				contentValidator(""))
 		})
+
+		t.Run("recap", func(t *testing.T) {
+			tester(
+				t,
+				recapFac,
+				res,
+				nil,
+				contentValidator(""))
+		})
 	})
 
 	t.Run("buffered", func(t *testing.T) {
@@ -161,6 +174,17 @@ func TestResponseWriter(t *testing.T) {
 				nil,
 				contentValidator(content))
 		})
+
+		t.Run("recap", func(t *testing.T) {
+			tester(
+				t,
+				recapFac,
+				res,
+				nil,
+				contentValidator(fmt.Sprintf(
+					"assistant: %s\n\nfinish_reason: stop\nusage: prompt_tokens=58 completion_tokens=83 total_tokens=141\n",
+					content)))
+		})
 	})
 
 	t.Run("stream", func(t *testing.T) {
@@ -348,5 +372,363 @@ func TestResponseWriter(t *testing.T) {
 				res,
 				contentValidator(fmt.Sprintf(strings.Repeat("%s", len(content)), content...)))
 		})
+
+		t.Run("recap", func(t *testing.T) {
+			tester(
+				t,
+				recapFac,
+				nil,
+				res,
+				contentValidator(fmt.Sprintf(
+					"assistant: "+strings.Repeat("%s", len(content))+"\n\nfinish_reason: stop\n",
+					content...)))
+		})
+	})
+
+	t.Run("stream tool calls", func(t *testing.T) {
+		res, _ := resStreamFac(
+			t,
+			`[
+  {
+    "choices": [
+      {
+        "delta": {
+          "role": "assistant",
+          "tool_calls": [
+            {"index": 0, "id": "call_1", "type": "function", "function": {"name": "date", "arguments": ""}}
+          ]
+        },
+        "finish_reason": null,
+        "index": 0
+      }
+    ]
+  },
+  {
+    "choices": [
+      {
+        "delta": {
+          "tool_calls": [
+            {"index": 0, "function": {"arguments": "+%Y"}}
+          ]
+        },
+        "finish_reason": null,
+        "index": 0
+      }
+    ]
+  },
+  {
+    "choices": [
+      {
+        "delta": {},
+        "finish_reason": "tool_calls",
+        "index": 0
+      }
+    ]
+  },
+  {
+    "choices": [],
+    "usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+  }
+]`)
+
+		t.Run("recap", func(t *testing.T) {
+			tester(
+				t,
+				recapFac,
+				nil,
+				res,
+				contentValidator(""+
+					"assistant tool call (call_1): date(+%Y)\n\n"+
+					"finish_reason: tool_calls\n"+
+					"usage: prompt_tokens=10 completion_tokens=5 total_tokens=15\n"))
+		})
+	})
+}
+
+func TestRecapResponseWriterTranscript(t *testing.T) {
+	var buf strings.Builder
+	w := &chatcompletion.RecapResponseWriter{W: &buf}
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+			{Role: openai.ChatMessageRoleUser, Content: "what year is it?"},
+		},
+	}
+	toolCallMessage := openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{
+			{
+				ID:       "call_1",
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "date", Arguments: "+%Y"},
+			},
+		},
+	}
+
+	require.NoError(t, w.WriteRequest(req))
+	require.NoError(t, w.Write(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{Message: toolCallMessage, FinishReason: openai.FinishReasonToolCalls},
+		},
+	}))
+
+	req.Messages = append(
+		req.Messages,
+		toolCallMessage,
+		openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Name:       "date",
+			ToolCallID: "call_1",
+			Content:    "2025",
+		})
+	require.NoError(t, w.WriteRequest(req))
+	require.NoError(t, w.Write(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: "2025",
+				},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+	}))
+
+	require.Equal(
+		t,
+		""+
+			"system: be brief\n\n"+
+			"user: what year is it?\n\n"+
+			"assistant tool call (call_1): date(+%Y)\n\n"+
+			"finish_reason: tool_calls\n"+
+			"tool (date call_1): 2025\n\n"+
+			"assistant: 2025\n\n"+
+			"finish_reason: stop\n",
+		buf.String())
+}
+
+func TestRecapResponseWriterMultiContent(t *testing.T) {
+	var buf strings.Builder
+	w := &chatcompletion.RecapResponseWriter{W: &buf}
+
+	require.NoError(t, w.WriteRequest(openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: []openai.ChatMessagePart{
+					{Type: openai.ChatMessagePartTypeText, Text: "what is this?"},
+					{
+						Type:     openai.ChatMessagePartTypeImageURL,
+						ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,iVBORw0KGgo="},
+					},
+				},
+			},
+		},
+	}))
+
+	require.Equal(t, "user: what is this?\n\n[image: data:image/png]\n\n", buf.String())
+}
+
+func TestResponseWriterMultipleChoices(t *testing.T) {
+	req := openai.ChatCompletionRequest{N: 2}
+	res := openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Index:        0,
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "red"},
+				FinishReason: openai.FinishReasonStop,
+			},
+			{
+				Index:        1,
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "blue"},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+	}
+	chunk := func(index int, content string, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{
+				{
+					Index:        index,
+					Delta:        openai.ChatCompletionStreamChoiceDelta{Content: content},
+					FinishReason: finishReason,
+				},
+			},
+		}
+	}
+	// interleaved the way servers send them
+	sres := []openai.ChatCompletionStreamResponse{
+		chunk(0, "r", ""),
+		chunk(1, "bl", ""),
+		chunk(1, "ue", ""),
+		chunk(0, "ed", ""),
+		chunk(1, "", openai.FinishReasonStop),
+		chunk(0, "", openai.FinishReasonStop),
+	}
+
+	tester := func(
+		t *testing.T,
+		w chatcompletion.ResponseWriter,
+		buf *strings.Builder,
+		stream bool,
+		expected string,
+	) {
+		require.NoError(t, w.WriteRequest(req))
+		if stream {
+			for _, r := range sres {
+				require.NoError(t, w.WriteStream(r))
+			}
+			require.NoError(t, w.(chatcompletion.StreamFlusher).FlushStream())
+		} else {
+			require.NoError(t, w.Write(res))
+		}
+		require.Equal(t, expected, buf.String())
+	}
+
+	contentExpected := "--- choice 0 ---\nred\n\n--- choice 1 ---\nblue\n\n"
+	recapExpected := "" +
+		"assistant (choice 0): red\n\n" +
+		"finish_reason (choice 0): stop\n" +
+		"assistant (choice 1): blue\n\n" +
+		"finish_reason (choice 1): stop\n"
+
+	t.Run("content buffered", func(t *testing.T) {
+		var buf strings.Builder
+		tester(t, &chatcompletion.ContentResponseWriter{W: &buf}, &buf, false, contentExpected)
+	})
+
+	t.Run("content stream", func(t *testing.T) {
+		var buf strings.Builder
+		tester(t, &chatcompletion.ContentResponseWriter{W: &buf}, &buf, true, contentExpected)
+	})
+
+	t.Run("recap buffered", func(t *testing.T) {
+		var buf strings.Builder
+		tester(t, &chatcompletion.RecapResponseWriter{W: &buf}, &buf, false, recapExpected)
+	})
+
+	t.Run("recap stream", func(t *testing.T) {
+		var buf strings.Builder
+		tester(t, &chatcompletion.RecapResponseWriter{W: &buf}, &buf, true, recapExpected)
+	})
+
+	t.Run("raw stream", func(t *testing.T) {
+		var buf strings.Builder
+		w := &chatcompletion.RawResponseWriter{W: &buf}
+		require.NoError(t, w.WriteRequest(req))
+		for _, r := range sres {
+			require.NoError(t, w.WriteStream(r))
+		}
+		require.NoError(t, w.FlushStream())
+
+		actual := []string{}
+		dec := json.NewDecoder(strings.NewReader(buf.String()))
+		for dec.More() {
+			var r openai.ChatCompletionStreamResponse
+			require.NoError(t, dec.Decode(&r))
+			require.Len(t, r.Choices, 1)
+			actual = append(
+				actual,
+				fmt.Sprintf("%d:%s:%s", r.Choices[0].Index, r.Choices[0].Delta.Content, r.Choices[0].FinishReason))
+		}
+		require.Equal(
+			t,
+			[]string{"0:r:", "0:ed:", "0::stop", "1:bl:", "1:ue:", "1::stop"},
+			actual)
+	})
+
+	t.Run("content buffer choice", func(t *testing.T) {
+		var buf strings.Builder
+		contentBuf := chatcompletion.NewResponseWriterContentBufferForChoice(
+			&chatcompletion.ContentResponseWriter{W: &buf},
+			1)
+		tester(t, contentBuf, &buf, true, contentExpected)
+		require.Equal(t, "blue", contentBuf.String())
+	})
+}
+
+func TestResponseWriterToolCallIndex(t *testing.T) {
+	chunk := func(index *int, id string, arguments string) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta: openai.ChatCompletionStreamChoiceDelta{
+					ToolCalls: []openai.ToolCall{{
+						Index:    index,
+						ID:       id,
+						Function: openai.FunctionCall{Arguments: arguments},
+					}},
+				},
+			}},
+		}
+	}
+	ptr := func(i int) *int { return &i }
+
+	tester := func(t *testing.T, sres []openai.ChatCompletionStreamResponse, expected string, expectedErr string) {
+		writeStream := func(w chatcompletion.ResponseWriter) error {
+			for _, r := range sres {
+				err := w.WriteStream(r)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var buf strings.Builder
+		w, err := chatcompletion.NewTemplateResponseWriter(
+			&buf,
+			`{{ range (index .Response.Choices 0).Message.ToolCalls }}{{ .ID }}={{ .Function.Arguments }};{{ end }}`,
+			"")
+		require.NoError(t, err)
+		recap := &chatcompletion.RecapResponseWriter{W: io.Discard}
+
+		if expectedErr != "" {
+			require.ErrorContains(t, writeStream(w), expectedErr)
+			require.ErrorContains(t, writeStream(recap), expectedErr)
+			return
+		}
+		require.NoError(t, writeStream(w))
+		require.NoError(t, w.FlushStream())
+		require.Equal(t, expected, buf.String())
+		require.NoError(t, writeStream(recap))
+	}
+
+	t.Run("indexed", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionStreamResponse{
+				chunk(ptr(0), "call_1", `{"a":`),
+				chunk(ptr(1), "call_2", `{"b":2}`),
+				chunk(ptr(0), "", `1}`),
+			},
+			`call_1={"a":1};call_2={"b":2};`,
+			"")
+	})
+	t.Run("without index", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionStreamResponse{
+				chunk(nil, "call_1", `{"a":`),
+				chunk(nil, "", `1}`),
+				chunk(nil, "call_2", `{"b":`),
+				chunk(nil, "", `2}`),
+			},
+			`call_1={"a":1};call_2={"b":2};`,
+			"")
+	})
+	t.Run("negative", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionStreamResponse{chunk(ptr(-1), "call_1", "")},
+			"",
+			"tool call index -1 is negative")
+	})
+	t.Run("out of order", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionStreamResponse{chunk(ptr(2000000000), "call_1", "")},
+			"",
+			"tool call index 2000000000 is out of order, expected at most 0")
 	})
 }
@@ -0,0 +1,237 @@
+package chatcompletion
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var _ ResponseWriter = &TemplateResponseWriter{}
+
+// TemplateData is the data available to the templates of a
+// TemplateResponseWriter.
+type TemplateData struct {
+	// Chunk is the current stream chunk, only set for the chunk template.
+	Chunk    openai.ChatCompletionStreamResponse
+	Request  openai.ChatCompletionRequest
+	Response openai.ChatCompletionResponse
+	Timing   TemplateTiming
+}
+
+// TemplateTiming is the timing of the request being rendered.
+type TemplateTiming struct {
+	// Elapsed is the time from sending the request until rendering.
+	Elapsed time.Duration
+	// FirstChunk is the time from sending the request until the first stream
+	// chunk was received, zero for buffered responses.
+	FirstChunk time.Duration
+	Start      time.Time
+}
+
+// TemplateResponseWriter renders each response thru a text/template. When
+// streaming, the chunks are accumulated into a response that is rendered once
+// the stream ends, and the optional chunk template is rendered for each chunk
+// as it arrives.
+type TemplateResponseWriter struct {
+	W io.Writer
+
+	chunk    *template.Template
+	data     TemplateData
+	response *template.Template
+	streamed bool
+}
+
+func (b *TemplateResponseWriter) FlushStream() error {
+	if !b.streamed {
+		return nil
+	}
+	b.streamed = false
+
+	err := b.render(b.response)
+	if err != nil {
+		return fmt.Errorf("templateresponsewriter flushstream: %w", err)
+	}
+	return nil
+}
+
+func (b *TemplateResponseWriter) Write(res openai.ChatCompletionResponse) error {
+	b.data.Response = res
+	err := b.render(b.response)
+	if err != nil {
+		return fmt.Errorf("templateresponsewriter write: %w", err)
+	}
+	return nil
+}
+
+func (b *TemplateResponseWriter) WriteRequest(req openai.ChatCompletionRequest) error {
+	b.data = TemplateData{
+		Request: req,
+		Timing:  TemplateTiming{Start: time.Now()},
+	}
+	b.streamed = false
+	return nil
+}
+
+func (b *TemplateResponseWriter) WriteStream(res openai.ChatCompletionStreamResponse) error {
+	if !b.streamed {
+		b.streamed = true
+		b.data.Timing.FirstChunk = time.Since(b.data.Timing.Start)
+	}
+
+	err := accumulateStreamResponse(&b.data.Response, res)
+	if err != nil {
+		return fmt.Errorf("templateresponsewriter writestream: %w", err)
+	}
+
+	b.data.Chunk = res
+	err = b.render(b.chunk)
+	b.data.Chunk = openai.ChatCompletionStreamResponse{}
+	if err != nil {
+		return fmt.Errorf("templateresponsewriter writestream: %w", err)
+	}
+	return nil
+}
+
+func (b *TemplateResponseWriter) render(tmpl *template.Template) error {
+	if tmpl == nil {
+		return nil
+	}
+
+	b.data.Timing.Elapsed = time.Since(b.data.Timing.Start)
+	err := tmpl.Execute(b.W, b.data)
+	if err != nil {
+		return fmt.Errorf("execute %s: %w", tmpl.Name(), err)
+	}
+	return nil
+}
+
+// NewTemplateResponseWriter parses the supplied templates, either of which may
+// be empty, and returns a writer that renders them to w.
+func NewTemplateResponseWriter(
+	w io.Writer,
+	responseTemplate string,
+	chunkTemplate string,
+) (*TemplateResponseWriter, error) {
+	b := TemplateResponseWriter{W: w}
+
+	if responseTemplate != "" {
+		tmpl, err := template.New("response").Funcs(TemplateFuncs()).Parse(responseTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse response template: %w", err)
+		}
+		b.response = tmpl
+	}
+
+	if chunkTemplate != "" {
+		tmpl, err := template.New("chunk").Funcs(TemplateFuncs()).Parse(chunkTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse chunk template: %w", err)
+		}
+		b.chunk = tmpl
+	}
+
+	return &b, nil
+}
+
+// TemplateFuncs returns the functions available to the templates of a
+// TemplateResponseWriter in addition to the text/template builtins:
+//
+//   - csv: encodes its arguments as a single CSV record (without newline)
+//   - json: encodes its argument as JSON
+//   - trim: removes leading and trailing whitespace
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csv": func(fields ...any) (string, error) {
+			record := make([]string, 0, len(fields))
+			for _, field := range fields {
+				record = append(record, fmt.Sprint(field))
+			}
+
+			var buf strings.Builder
+			w := csv.NewWriter(&buf)
+			err := w.Write(record)
+			if err != nil {
+				return "", fmt.Errorf("csv: %w", err)
+			}
+			w.Flush()
+			return strings.TrimSuffix(buf.String(), "\n"), nil
+		},
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return "", fmt.Errorf("json: %w", err)
+			}
+			return string(data), nil
+		},
+		"trim": strings.TrimSpace,
+	}
+}
+
+// accumulateStreamResponse merges the stream chunk res into the response acc
+// so that a stream can be treated like a buffered response once complete.
+func accumulateStreamResponse(acc *openai.ChatCompletionResponse, res openai.ChatCompletionStreamResponse) error {
+	if res.ID != "" {
+		acc.ID = res.ID
+	}
+	if res.Model != "" {
+		acc.Model = res.Model
+	}
+	if res.Created != 0 {
+		acc.Created = res.Created
+	}
+	if res.SystemFingerprint != "" {
+		acc.SystemFingerprint = res.SystemFingerprint
+	}
+	acc.Object = "chat.completion"
+	if res.Usage != nil {
+		acc.Usage = *res.Usage
+	}
+
+	for _, choice := range res.Choices {
+		for len(acc.Choices) <= choice.Index {
+			acc.Choices = append(
+				acc.Choices,
+				openai.ChatCompletionChoice{
+					Index:   len(acc.Choices),
+					Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant},
+				})
+		}
+
+		accChoice := &acc.Choices[choice.Index]
+		if choice.Delta.Role != "" {
+			accChoice.Message.Role = choice.Delta.Role
+		}
+		accChoice.Message.Content += choice.Delta.Content
+		accChoice.Message.ReasoningContent += choice.Delta.ReasoningContent
+		accChoice.Message.Refusal += choice.Delta.Refusal
+		var err error
+		accChoice.Message.ToolCalls, err = mergeToolCallDeltas(accChoice.Message.ToolCalls, choice.Delta.ToolCalls)
+		if err != nil {
+			return err
+		}
+		if isFinished(choice.FinishReason) {
+			accChoice.FinishReason = choice.FinishReason
+		}
+		if choice.Logprobs != nil {
+			if accChoice.LogProbs == nil {
+				accChoice.LogProbs = &openai.LogProbs{}
+			}
+			for _, lp := range choice.Logprobs.Content {
+				logProb := openai.LogProb{Token: lp.Token, LogProb: lp.Logprob}
+				for _, top := range lp.TopLogprobs {
+					logProb.TopLogProbs = append(
+						logProb.TopLogProbs,
+						openai.TopLogProbs{Token: top.Token, LogProb: top.Logprob})
+				}
+				accChoice.LogProbs.Content = append(accChoice.LogProbs.Content, logProb)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package chatcompletion_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateResponseWriter(t *testing.T) {
+	tester := func(
+		t *testing.T,
+		responseTemplate string,
+		chunkTemplate string,
+		res *openai.ChatCompletionResponse,
+		sres []openai.ChatCompletionStreamResponse,
+		expected string,
+	) {
+		var buf strings.Builder
+		w, err := chatcompletion.NewTemplateResponseWriter(&buf, responseTemplate, chunkTemplate)
+		require.NoError(t, err)
+
+		require.NoError(t, w.WriteRequest(openai.ChatCompletionRequest{Model: "llama3"}))
+		if res != nil {
+			require.NoError(t, w.Write(*res))
+		}
+		for _, r := range sres {
+			require.NoError(t, w.WriteStream(r))
+		}
+		require.NoError(t, w.FlushStream())
+
+		require.Equal(t, expected, buf.String())
+	}
+
+	t.Run("buffered csv", func(t *testing.T) {
+		tester(
+			t,
+			`{{ csv .Request.Model (index .Response.Choices 0).Message.Content .Response.Usage.TotalTokens }}`,
+			"",
+			&openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{Message: openai.ChatCompletionMessage{Content: "hello, world"}},
+				},
+				Usage: openai.Usage{TotalTokens: 12},
+			},
+			nil,
+			`llama3,"hello, world",12`)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		chunk := func(content string, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+			return openai.ChatCompletionStreamResponse{
+				Model: "llama3:8b",
+				Choices: []openai.ChatCompletionStreamChoice{
+					{
+						Delta:        openai.ChatCompletionStreamChoiceDelta{Content: content},
+						FinishReason: finishReason,
+					},
+				},
+			}
+		}
+
+		tester(
+			t,
+			`|{{ .Response.Model }} {{ (index .Response.Choices 0).Message.Content | trim }} {{ (index .Response.Choices 0).FinishReason }}`,
+			`{{ range .Chunk.Choices }}[{{ .Delta.Content }}]{{ end }}`,
+			nil,
+			[]openai.ChatCompletionStreamResponse{
+				chunk(" foo", ""),
+				chunk(" bar ", ""),
+				chunk("", openai.FinishReasonStop),
+			},
+			"[ foo][ bar ][]|llama3:8b foo bar stop")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := chatcompletion.NewTemplateResponseWriter(nil, "{{ .Foo", "")
+		require.Error(t, err)
+	})
+}
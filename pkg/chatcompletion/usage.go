@@ -0,0 +1,191 @@
+package chatcompletion
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+var _ ResponseWriter = &ResponseWriterUsageAccumulator{}
+
+// ResponseWriterUsageAccumulator passes responses thru to the wrapped writer
+// while collecting the usage reported for each round of the exchange. There
+// will be more than one round when tool calls are made.
+type ResponseWriterUsageAccumulator struct {
+	// current is the model of the current round.
+	current roundModel
+	// models are the models of each of the rounds.
+	models []roundModel
+	rounds []openai.Usage
+	w      ResponseWriter
+}
+
+// roundModel is the model of a round. Servers often report a different name
+// for the model than was requested, such as a dated version of it.
+type roundModel struct {
+	reported  string
+	requested string
+}
+
+func (b *ResponseWriterUsageAccumulator) FlushStream() error {
+	return flushStream(b.w)
+}
+
+func (b *ResponseWriterUsageAccumulator) Rounds() []openai.Usage {
+	return b.rounds
+}
+
+func (b *ResponseWriterUsageAccumulator) Total() openai.Usage {
+	var total openai.Usage
+	for _, usage := range b.rounds {
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.TotalTokens += usage.TotalTokens
+	}
+	return total
+}
+
+func (b *ResponseWriterUsageAccumulator) Write(res openai.ChatCompletionResponse) error {
+	err := b.w.Write(res)
+	if err != nil {
+		return fmt.Errorf("pass-thru write: %w", err)
+	}
+
+	if res.Model != "" {
+		b.current.reported = res.Model
+	}
+	b.addRound(res.Usage)
+	return nil
+}
+
+func (b *ResponseWriterUsageAccumulator) WriteRequest(req openai.ChatCompletionRequest) error {
+	err := b.w.WriteRequest(req)
+	if err != nil {
+		return fmt.Errorf("pass-thru write request: %w", err)
+	}
+	b.current = roundModel{requested: req.Model}
+	return nil
+}
+
+func (b *ResponseWriterUsageAccumulator) WriteStream(res openai.ChatCompletionStreamResponse) error {
+	err := b.w.WriteStream(res)
+	if err != nil {
+		return fmt.Errorf("pass-thru write stream: %w", err)
+	}
+
+	if res.Model != "" {
+		b.current.reported = res.Model
+	}
+	// only present in the final chunk when stream_options.include_usage is set
+	if res.Usage != nil {
+		b.addRound(*res.Usage)
+	}
+	return nil
+}
+
+// WriteSummary writes the usage of each round followed by the total. If
+// pricing returns the pricing of the model of each round, the cost is
+// included. Pricing is looked up by the model the response reported and then
+// by the model that was requested.
+func (b *ResponseWriterUsageAccumulator) WriteSummary(
+	w io.Writer,
+	pricing func(model string) *config.ModelPricing,
+) error {
+	if len(b.rounds) == 0 {
+		_, err := fmt.Fprintln(w, "usage: not reported by server")
+		if err != nil {
+			return fmt.Errorf("write summary: %w", err)
+		}
+		return nil
+	}
+
+	// the total cost is only known if the cost of every round is
+	var total *float64
+	costs := make([]*float64, len(b.rounds))
+	if pricing != nil {
+		total = new(float64)
+		for i, usage := range b.rounds {
+			modelPricing := b.models[i].pricing(pricing)
+			if modelPricing == nil {
+				total = nil
+				continue
+			}
+			cost := modelPricing.Cost(usage)
+			costs[i] = &cost
+			if total != nil {
+				*total += cost
+			}
+		}
+	}
+
+	if len(b.rounds) > 1 {
+		for i, usage := range b.rounds {
+			err := writeUsageLine(w, fmt.Sprintf("usage round %d", i+1), usage, costs[i])
+			if err != nil {
+				return fmt.Errorf("write summary: %w", err)
+			}
+		}
+	}
+
+	err := writeUsageLine(w, "usage total", b.Total(), total)
+	if err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
+
+func NewResponseWriterUsageAccumulator(w ResponseWriter) *ResponseWriterUsageAccumulator {
+	return &ResponseWriterUsageAccumulator{w: w}
+}
+
+// addRound records the usage of a round unless it is empty, as it is when
+// the server did not report usage.
+func (b *ResponseWriterUsageAccumulator) addRound(usage openai.Usage) {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 && usage.TotalTokens == 0 {
+		return
+	}
+	b.rounds = append(b.rounds, usage)
+	b.models = append(b.models, b.current)
+}
+
+// pricing returns the pricing of the reported model, or if it has none, of
+// the requested model.
+func (m roundModel) pricing(pricing func(model string) *config.ModelPricing) *config.ModelPricing {
+	if m.reported != "" {
+		if p := pricing(m.reported); p != nil {
+			return p
+		}
+	}
+	if m.requested != "" {
+		return pricing(m.requested)
+	}
+	return nil
+}
+
+func writeUsageLine(w io.Writer, label string, usage openai.Usage, cost *float64) error {
+	_, err := fmt.Fprintf(
+		w,
+		"%s: prompt_tokens=%d completion_tokens=%d total_tokens=%d",
+		label,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.TotalTokens)
+	if err != nil {
+		return fmt.Errorf("write usage: %w", err)
+	}
+
+	if cost != nil {
+		_, err = fmt.Fprintf(w, " cost=%.6f", *cost)
+		if err != nil {
+			return fmt.Errorf("write cost: %w", err)
+		}
+	}
+
+	_, err = fmt.Fprintln(w)
+	if err != nil {
+		return fmt.Errorf("write usage: %w", err)
+	}
+	return nil
+}
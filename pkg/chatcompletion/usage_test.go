@@ -0,0 +1,130 @@
+package chatcompletion_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/chatcompletion"
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseWriterUsageAccumulator(t *testing.T) {
+	tester := func(
+		t *testing.T,
+		res []openai.ChatCompletionResponse,
+		sres []openai.ChatCompletionStreamResponse,
+		pricing map[string]config.ModelPricing,
+		expected string,
+	) {
+		acc := chatcompletion.NewResponseWriterUsageAccumulator(
+			&chatcompletion.ContentResponseWriter{W: io.Discard})
+
+		require.NoError(t, acc.WriteRequest(openai.ChatCompletionRequest{Model: "alias"}))
+		for _, r := range res {
+			require.NoError(t, acc.Write(r))
+		}
+		for _, r := range sres {
+			require.NoError(t, acc.WriteStream(r))
+		}
+
+		var lookup func(string) *config.ModelPricing
+		if pricing != nil {
+			endpoint := config.EndpointConfig{Pricing: pricing}
+			lookup = endpoint.ModelPricing
+		}
+
+		var buf strings.Builder
+		require.NoError(t, acc.WriteSummary(&buf, lookup))
+		require.Equal(t, expected, buf.String())
+	}
+
+	t.Run("not reported", func(t *testing.T) {
+		tester(
+			t,
+			nil,
+			[]openai.ChatCompletionStreamResponse{
+				{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "hi"}}}},
+			},
+			nil,
+			"usage: not reported by server\n")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		tester(
+			t,
+			nil,
+			[]openai.ChatCompletionStreamResponse{
+				{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "hi"}}}},
+				{Usage: &openai.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}},
+			},
+			nil,
+			"usage total: prompt_tokens=10 completion_tokens=2 total_tokens=12\n")
+	})
+
+	t.Run("tool call rounds with pricing", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionResponse{
+				{Model: "gpt", Usage: openai.Usage{PromptTokens: 1_000_000, CompletionTokens: 10, TotalTokens: 1_000_010}},
+				{Model: "gpt", Usage: openai.Usage{PromptTokens: 2_000_000, CompletionTokens: 500_000, TotalTokens: 2_500_000}},
+			},
+			nil,
+			map[string]config.ModelPricing{"alias": {Input: 100, Output: 100}, "gpt": {Input: 0.5, Output: 2}},
+			""+
+				"usage round 1: prompt_tokens=1000000 completion_tokens=10 total_tokens=1000010 cost=0.500020\n"+
+				"usage round 2: prompt_tokens=2000000 completion_tokens=500000 total_tokens=2500000 cost=2.000000\n"+
+				"usage total: prompt_tokens=3000000 completion_tokens=500010 total_tokens=3500010 cost=2.500020\n")
+	})
+
+	t.Run("zero usage rounds are skipped", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionResponse{
+				{},
+				{Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}},
+			},
+			nil,
+			nil,
+			"usage total: prompt_tokens=10 completion_tokens=2 total_tokens=12\n")
+	})
+
+	t.Run("priced by requested model if not reported", func(t *testing.T) {
+		tester(
+			t,
+			nil,
+			[]openai.ChatCompletionStreamResponse{
+				{Usage: &openai.Usage{PromptTokens: 1_000_000, CompletionTokens: 0, TotalTokens: 1_000_000}},
+			},
+			map[string]config.ModelPricing{"alias": {Input: 1}},
+			"usage total: prompt_tokens=1000000 completion_tokens=0 total_tokens=1000000 cost=1.000000\n")
+	})
+
+	t.Run("priced by requested model if reported model is not priced", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionResponse{
+				{Model: "alias-2024-08-06", Usage: openai.Usage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+			},
+			nil,
+			map[string]config.ModelPricing{"alias": {Input: 2}},
+			"usage total: prompt_tokens=1000000 completion_tokens=0 total_tokens=1000000 cost=2.000000\n")
+	})
+
+	t.Run("total cost unknown if a round is not priced", func(t *testing.T) {
+		tester(
+			t,
+			[]openai.ChatCompletionResponse{
+				{Model: "gpt", Usage: openai.Usage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+				{Model: "other", Usage: openai.Usage{PromptTokens: 1_000_000, TotalTokens: 1_000_000}},
+			},
+			nil,
+			map[string]config.ModelPricing{"gpt": {Input: 1}},
+			""+
+				"usage round 1: prompt_tokens=1000000 completion_tokens=0 total_tokens=1000000 cost=1.000000\n"+
+				"usage round 2: prompt_tokens=1000000 completion_tokens=0 total_tokens=1000000\n"+
+				"usage total: prompt_tokens=2000000 completion_tokens=0 total_tokens=2000000\n")
+	})
+}
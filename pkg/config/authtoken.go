@@ -0,0 +1,264 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pastdev/askai/pkg/gemini"
+	"github.com/pastdev/askai/pkg/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// redacted replaces secrets when they are output.
+const redacted = "REDACTED"
+
+// Secret is a string that is redacted when output so that it is not revealed
+// by askai config or logs.
+type Secret string
+
+// authTransport sets the authorization header of each request to the token
+// from source, resolving it when the request is made rather than when the
+// client is created.
+type authTransport struct {
+	apiType openai.APIType
+	source  *tokenSource
+	wrapped http.RoundTripper
+}
+
+// tokenSource resolves an auth token from the first of a literal,
+// environment variable, file, or command that yields one.
+type tokenSource struct {
+	command string
+	env     string
+	file    string
+	literal Secret
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	expires time.Time
+	token   string
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.String())
+	if err != nil {
+		return nil, fmt.Errorf("marshal secret: %w", err)
+	}
+	return data, nil
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// tokenSource returns the source of the auth token or nil if no token is
+// configured.
+func (c *EndpointConfig) tokenSource() *tokenSource {
+	if c.AuthToken == "" && c.AuthTokenEnv == "" && c.AuthTokenFile == "" && c.AuthTokenCommand == "" {
+		if c.apiType() == openai.APITypeAzureAD {
+			return &tokenSource{command: azureADTokenCommand, ttl: azureADTokenTTL}
+		}
+		return nil
+	}
+	return &tokenSource{
+		command: c.AuthTokenCommand,
+		env:     c.AuthTokenEnv,
+		file:    c.AuthTokenFile,
+		literal: c.AuthToken,
+		ttl:     time.Duration(c.AuthTokenCommandTTL),
+	}
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("auth token: %w", err)
+	}
+
+	r = r.Clone(r.Context())
+	setAuthHeader(r.Header, t.apiType, token)
+
+	return t.wrapped.RoundTrip(r)
+}
+
+// setAuthHeader sets the header that authorizes requests to endpoints of
+// apiType.
+func setAuthHeader(header http.Header, apiType openai.APIType, token string) {
+	switch apiType {
+	case openai.APITypeAzure, openai.APITypeCloudflareAzure:
+		header.Set(openai.AzureAPIKeyHeader, token)
+	case openai.APITypeAnthropic:
+		header.Set("x-api-key", token)
+	case gemini.APIType:
+		header.Set("x-goog-api-key", token)
+	default:
+		header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// Token returns the token from the literal, environment variable, file, or
+// command, in that order, skipping those that are not configured or empty.
+func (s *tokenSource) Token() (string, error) {
+	if s.literal != "" {
+		return string(s.literal), nil
+	}
+
+	var errs []error
+	if s.env != "" {
+		token := strings.TrimSpace(os.Getenv(s.env))
+		if token != "" {
+			return token, nil
+		}
+		errs = append(errs, fmt.Errorf("env %s is not set", s.env))
+	}
+
+	if s.file != "" {
+		token, err := s.fileToken()
+		if err == nil {
+			return token, nil
+		}
+		errs = append(errs, err)
+	}
+
+	if s.command != "" {
+		token, err := s.commandToken()
+		if err == nil {
+			return token, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return "", errors.Join(errs...)
+}
+
+// cacheFile returns the location the output of the command is cached.
+func (s *tokenSource) cacheFile() string {
+	dir, ok := os.LookupEnv("XDG_CACHE_HOME")
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		// default value of XDG_CACHE_HOME:
+		//   https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html#variables
+		dir = filepath.Join(home, ".cache")
+	}
+
+	sum := sha256.Sum256([]byte(s.command))
+	return filepath.Join(dir, "askai", "tokens", hex.EncodeToString(sum[:]))
+}
+
+// commandToken returns the output of the command. If a ttl is configured,
+// the output is cached, both in memory and on disk so it can be shared by
+// later invocations, until the ttl expires.
+func (s *tokenSource) commandToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.token != "" && now.Before(s.expires) {
+		return s.token, nil
+	}
+
+	cacheFile := s.cacheFile()
+	if s.ttl > 0 {
+		info, err := os.Stat(cacheFile)
+		if err == nil && now.Before(info.ModTime().Add(s.ttl)) {
+			//nolint: gosec // the location is derived from the cache dir
+			data, err := os.ReadFile(cacheFile)
+			if token := strings.TrimSpace(string(data)); err == nil && token != "" {
+				s.token = token
+				s.expires = info.ModTime().Add(s.ttl)
+				return token, nil
+			}
+		}
+	}
+
+	log.Debug().Str("command", s.command).Msg("running auth token command")
+	//nolint: gosec // the intent is to run the command the user configured
+	cmd := exec.Command("sh", "-c", s.command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("auth token command: %w", err)
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.New("auth token command: no output")
+	}
+
+	if s.ttl > 0 {
+		s.token = token
+		s.expires = now.Add(s.ttl)
+
+		err := writeCachedToken(cacheFile, token)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to cache auth token")
+		}
+	}
+	return token, nil
+}
+
+func (s *tokenSource) fileToken() (string, error) {
+	file, err := expandHome(s.file)
+	if err != nil {
+		return "", fmt.Errorf("auth token file: %w", err)
+	}
+
+	//nolint: gosec // the intent is to read the token from a user supplied location
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("auth token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("auth token file %s is empty", s.file)
+	}
+	return token, nil
+}
+
+func writeCachedToken(file string, token string) error {
+	err := os.MkdirAll(filepath.Dir(file), 0o700)
+	if err != nil {
+		return fmt.Errorf("create token cache dir: %w", err)
+	}
+
+	err = os.WriteFile(file, []byte(token), 0o600)
+	if err != nil {
+		return fmt.Errorf("write token cache: %w", err)
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~/ in path with the home directory.
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("home dir: %w", err)
+	}
+	return filepath.Join(home, rest), nil
+}
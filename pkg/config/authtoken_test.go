@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAuthToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = fmt.Fprint(w, `{"object":"list","data":[]}`)
+	}))
+	defer server.Close()
+
+	tester := func(t *testing.T, endpoint config.EndpointConfig, expected string, expectedErr string) {
+		authorization = ""
+		endpoint.BaseURL = server.URL
+		_, err := endpoint.NewClient().ListModels(context.Background())
+		if expectedErr != "" {
+			require.ErrorContains(t, err, expectedErr)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, expected, authorization)
+	}
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0o600))
+
+	t.Run("literal", func(t *testing.T) {
+		tester(t, config.EndpointConfig{AuthToken: "literal", AuthTokenEnv: "ASKAI_TEST_TOKEN"}, "Bearer literal", "")
+	})
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("ASKAI_TEST_TOKEN", "env-token")
+		tester(t, config.EndpointConfig{AuthTokenEnv: "ASKAI_TEST_TOKEN", AuthTokenFile: tokenFile}, "Bearer env-token", "")
+	})
+	t.Run("env unset falls back to file", func(t *testing.T) {
+		t.Setenv("ASKAI_TEST_TOKEN", "")
+		tester(t, config.EndpointConfig{AuthTokenEnv: "ASKAI_TEST_TOKEN", AuthTokenFile: tokenFile}, "Bearer file-token", "")
+	})
+	t.Run("command", func(t *testing.T) {
+		tester(t, config.EndpointConfig{AuthTokenCommand: "echo command-token"}, "Bearer command-token", "")
+	})
+	t.Run("none", func(t *testing.T) {
+		t.Setenv("ASKAI_TEST_TOKEN", "")
+		tester(t, config.EndpointConfig{AuthTokenEnv: "ASKAI_TEST_TOKEN"}, "", "env ASKAI_TEST_TOKEN is not set")
+	})
+	t.Run("command ttl", func(t *testing.T) {
+		t.Setenv("XDG_CACHE_HOME", t.TempDir())
+		count := filepath.Join(t.TempDir(), "count")
+		endpoint := config.EndpointConfig{
+			AuthTokenCommand:    fmt.Sprintf("echo run >> %s; echo cached-token", count),
+			AuthTokenCommandTTL: config.Duration(time.Hour),
+		}
+
+		// each client is like a separate invocation, so the second must be
+		// served from the disk cache
+		tester(t, endpoint, "Bearer cached-token", "")
+		tester(t, endpoint, "Bearer cached-token", "")
+		runs, err := os.ReadFile(count)
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(string(runs), "run"))
+	})
+}
+
+func TestSecretRedacted(t *testing.T) {
+	endpoint := config.EndpointConfig{AuthToken: "s3cr3t"}
+
+	data, err := json.Marshal(endpoint)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "s3cr3t")
+	require.Contains(t, string(data), `"auth_token":"REDACTED"`)
+
+	data, err = yaml.Marshal(endpoint)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "s3cr3t")
+
+	var loaded config.EndpointConfig
+	require.NoError(t, yaml.Unmarshal([]byte("auth_token: s3cr3t\nauth_token_command_ttl: 5m\n"), &loaded))
+	require.Equal(t, config.Secret("s3cr3t"), loaded.AuthToken)
+	require.Equal(t, config.Duration(5*time.Minute), loaded.AuthTokenCommandTTL)
+	require.Equal(t, "REDACTED", fmt.Sprint(loaded.AuthToken))
+}
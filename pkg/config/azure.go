@@ -0,0 +1,50 @@
+package config
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// azureADTokenCommand obtains an azure ad token for AZURE_AD endpoints
+	// that do not configure one.
+	azureADTokenCommand = "az account get-access-token" +
+		" --resource https://cognitiveservices.azure.com" +
+		" --query accessToken --output tsv"
+	// azureADTokenTTL is how long tokens from azureADTokenCommand are cached,
+	// they are valid for at least an hour.
+	azureADTokenTTL = 45 * time.Minute
+	// defaultAzureAPIVersion is the api-version sent if an azure endpoint does
+	// not configure an api version.
+	defaultAzureAPIVersion = "2024-10-21"
+)
+
+// azureDeploymentChars are the characters removed from a model name to get
+// the name of its deployment if it is not mapped. this matches the default of
+// the openai client.
+var azureDeploymentChars = regexp.MustCompile(`[.:]`)
+
+// apiType returns the api type of the endpoint.
+func (c *EndpointConfig) apiType() openai.APIType {
+	switch {
+	case c.AzureAD:
+		return openai.APITypeAzureAD
+	case c.APIType == "":
+		return openai.APITypeOpenAI
+	}
+	return c.APIType
+}
+
+// azureDeployment returns the name of the deployment of model.
+func (c *EndpointConfig) azureDeployment(model string) string {
+	if deployment, ok := c.AzureDeployments[model]; ok {
+		return deployment
+	}
+	return azureDeploymentChars.ReplaceAllString(model, "")
+}
+
+func isAzure(apiType openai.APIType) bool {
+	return apiType == openai.APITypeAzure || apiType == openai.APITypeAzureAD
+}
@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzure(t *testing.T) {
+	tester := func(
+		t *testing.T,
+		azureAD bool,
+		model string,
+		expectedURL string,
+		expectedHeader string,
+		expectedValue string,
+	) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, expectedURL, r.URL.String())
+			require.Equal(t, expectedValue, r.Header.Get(expectedHeader))
+			_, _ = fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`)
+		}))
+		t.Cleanup(server.Close)
+
+		endpoint := config.EndpointConfig{
+			APIType:          openai.APITypeAzure,
+			AuthToken:        "secret",
+			AzureAD:          azureAD,
+			AzureDeployments: map[string]string{"gpt-4o": "gpt4o-prod"},
+			BaseURL:          server.URL,
+		}
+		resp, err := endpoint.NewClient().CreateChatCompletion(
+			context.Background(),
+			openai.ChatCompletionRequest{
+				Model:    model,
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			})
+		require.NoError(t, err)
+		require.Equal(t, "hi", resp.Choices[0].Message.Content)
+	}
+
+	t.Run("mapped deployment", func(t *testing.T) {
+		tester(t, false, "gpt-4o",
+			"/openai/deployments/gpt4o-prod/chat/completions?api-version=2024-10-21",
+			"api-key", "secret")
+	})
+	t.Run("unmapped deployment", func(t *testing.T) {
+		tester(t, false, "gpt-4.1",
+			"/openai/deployments/gpt-41/chat/completions?api-version=2024-10-21",
+			"api-key", "secret")
+	})
+	t.Run("azure ad", func(t *testing.T) {
+		tester(t, true, "gpt-4o",
+			"/openai/deployments/gpt4o-prod/chat/completions?api-version=2024-10-21",
+			"Authorization", "Bearer secret")
+	})
+}
@@ -8,8 +8,12 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"time"
 
+	"github.com/pastdev/askai/pkg/anthropic"
+	"github.com/pastdev/askai/pkg/gemini"
 	"github.com/pastdev/askai/pkg/log"
+	"github.com/pastdev/askai/pkg/ollama"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -27,26 +31,102 @@ endpoints:
 type Config struct {
 	Endpoints       map[string]EndpointConfig `json:"endpoints" yaml:"endpoints"`
 	DefaultEndpoint string                    `json:"default_endpoint" yaml:"default_endpoint"`
+	Presets         map[string]PresetConfig   `json:"presets" yaml:"presets"`
+	Prompts         map[string]PromptConfig   `json:"prompts" yaml:"prompts"`
 }
 
 // EndpointConfig is a configuration of a client.
 type EndpointConfig struct {
-	APIType                openai.APIType                `json:"api_type" yaml:"api_type"`
-	APIVersion             string                        `json:"api_version" yaml:"api_version"`
-	AuthToken              string                        `json:"auth_token" yaml:"auth_token"`
+	APIType    openai.APIType `json:"api_type" yaml:"api_type"`
+	APIVersion string         `json:"api_version" yaml:"api_version"`
+	// AuthToken is the literal token, for anything other than a local
+	// config prefer one of the other AuthToken options so the secret is not
+	// stored in the config.
+	AuthToken Secret `json:"auth_token" yaml:"auth_token"`
+	// AuthTokenCommand is a shell command whose output is the token.
+	AuthTokenCommand string `json:"auth_token_command" yaml:"auth_token_command"`
+	// AuthTokenCommandTTL is how long the output of AuthTokenCommand is
+	// cached, by default the command is run for every request.
+	AuthTokenCommandTTL Duration `json:"auth_token_command_ttl" yaml:"auth_token_command_ttl"`
+	// AuthTokenEnv is an environment variable containing the token.
+	AuthTokenEnv string `json:"auth_token_env" yaml:"auth_token_env"`
+	// AuthTokenFile is a file containing the token.
+	AuthTokenFile string `json:"auth_token_file" yaml:"auth_token_file"`
+	// AzureAD makes the endpoint an AZURE_AD endpoint, which authenticates
+	// with a Microsoft Entra ID (Azure AD) token rather than an api key. If
+	// none of the AuthToken options are set, the token is obtained from the
+	// azure cli.
+	AzureAD bool `json:"azure_ad" yaml:"azure_ad"`
+	// AzureDeployments maps model names to the names of their deployments on
+	// AZURE and AZURE_AD endpoints. Models that are not mapped use the model
+	// name without any . or :.
+	AzureDeployments       map[string]string             `json:"azure_deployments" yaml:"azure_deployments"`
 	BaseURL                string                        `json:"base_url" yaml:"base_url"`
 	ChatCompletionDefaults *openai.ChatCompletionRequest `json:"chat_completion_defaults" yaml:"chat_completion_defaults"`
 	CACerts                string                        `json:"cacerts" yaml:"cacerts"`
-	EmptyMessagesLimit     uint                          `json:"empty_messages_limit" yaml:"empty_messages_limit"`
-	ImageDefaults          *openai.ImageRequest          `json:"image_defaults" yaml:"image_defaults"`
-	InsecureSkipTLS        bool                          `json:"insecure_skip_tls" yaml:"insecure_skip_tls"`
-	OrgID                  string                        `json:"org_id" yaml:"org_id"`
+	// ClientCert is the certificate presented for mutual tls, either pem
+	// encoded or the path to a pem file. ClientKey is its private key.
+	ClientCert         string `json:"client_cert" yaml:"client_cert"`
+	ClientKey          Secret `json:"client_key" yaml:"client_key"`
+	EmptyMessagesLimit uint   `json:"empty_messages_limit" yaml:"empty_messages_limit"`
+	// Fallbacks are endpoints to try in order when a request to this endpoint
+	// fails.
+	Fallbacks []FallbackConfig `json:"fallbacks" yaml:"fallbacks"`
+	// FirstTokenTimeout limits the time until a response starts, for
+	// streamed responses that is the first chunk and for others the whole
+	// response.
+	FirstTokenTimeout Duration `json:"first_token_timeout" yaml:"first_token_timeout"`
+	// Headers are added to every request, for example the routing keys or
+	// tenant ids required by a gateway.
+	Headers         map[string]string    `json:"headers" yaml:"headers"`
+	ImageDefaults   *openai.ImageRequest `json:"image_defaults" yaml:"image_defaults"`
+	InsecureSkipTLS bool                 `json:"insecure_skip_tls" yaml:"insecure_skip_tls"`
+	// OllamaOptions are the model options, such as num_ctx and num_gpu, of
+	// OLLAMA endpoints. keep_alive may also be set.
+	OllamaOptions map[string]any `json:"ollama_options" yaml:"ollama_options"`
+	OrgID         string         `json:"org_id" yaml:"org_id"`
+	// Pricing maps a model name to its price, used to estimate the cost of a
+	// request from its reported usage.
+	Pricing map[string]ModelPricing `json:"pricing" yaml:"pricing"`
+	// ProxyURL is the proxy requests are sent through, by default the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used.
+	ProxyURL string `json:"proxy_url" yaml:"proxy_url"`
+	// Retry configures retrying failed requests, they are not retried unless
+	// it is set.
+	Retry *RetryConfig `json:"retry" yaml:"retry"`
+	// Timeout limits the time for a request including retries, fallbacks and
+	// reading the response. By default there is no limit.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+
+	fallbacks []fallback
+	name      string
+}
+
+// ModelPricing is the price of a model in currency units per million tokens.
+type ModelPricing struct {
+	Input  float64 `json:"input" yaml:"input"`
+	Output float64 `json:"output" yaml:"output"`
+}
+
+// credentialHeaders are redacted from logged requests.
+var credentialHeaders = []string{
+	"Authorization",
+	openai.AzureAPIKeyHeader,
+	"Proxy-Authorization",
+	"x-api-key",
+	"x-goog-api-key",
 }
 
 type loggingTransport struct {
 	wrapped http.RoundTripper
 }
 
+// Cost returns the cost of the supplied usage.
+func (p ModelPricing) Cost(usage openai.Usage) float64 {
+	return (float64(usage.PromptTokens)*p.Input +
+		float64(usage.CompletionTokens)*p.Output) / 1_000_000
+}
+
 func (c *Config) EndpointConfig(endpoint string) (*EndpointConfig, error) {
 	if endpoint == "" {
 		if c.DefaultEndpoint == "" {
@@ -59,32 +139,100 @@ func (c *Config) EndpointConfig(endpoint string) (*EndpointConfig, error) {
 	if !ok {
 		return nil, fmt.Errorf("endpoint %s not configured", endpoint)
 	}
+	clientCfg.name = endpoint
+
+	for _, fb := range clientCfg.Fallbacks {
+		if fb.Endpoint == endpoint {
+			return nil, fmt.Errorf("endpoint %s is its own fallback", endpoint)
+		}
+
+		fbCfg, ok := c.Endpoints[fb.Endpoint]
+		if !ok {
+			return nil, fmt.Errorf("endpoint %s fallback %s not configured", endpoint, fb.Endpoint)
+		}
+		fbCfg.name = fb.Endpoint
+		// the paths of azure requests differ from those of other endpoints
+		if isAzure(clientCfg.apiType()) != isAzure(fbCfg.apiType()) {
+			return nil, fmt.Errorf("endpoint %s fallback %s must be azure if and only if the endpoint is", endpoint, fb.Endpoint)
+		}
+
+		clientCfg.fallbacks = append(clientCfg.fallbacks, fallback{FallbackConfig: fb, endpoint: &fbCfg})
+	}
 
 	return &clientCfg, nil
 }
 
+// ModelPricing returns the pricing configured for model if any.
+func (c *EndpointConfig) ModelPricing(model string) *ModelPricing {
+	pricing, ok := c.Pricing[model]
+	if !ok {
+		return nil
+	}
+	return &pricing
+}
+
 func (c *EndpointConfig) NewClient() *openai.Client {
-	cfg := openai.DefaultConfig(c.AuthToken)
+	cfg := openai.DefaultConfig(string(c.AuthToken))
 
-	if c.BaseURL != "" {
-		cfg.BaseURL = c.BaseURL
-	}
+	cfg.BaseURL = c.baseURL()
 
 	if c.OrgID != "" {
 		cfg.OrgID = c.OrgID
 	}
 
-	if c.APIType != "" {
-		cfg.APIType = c.APIType
+	cfg.APIType = c.apiType()
+	if version := c.apiVersion(); version != "" {
+		cfg.APIVersion = version
 	}
-	if c.APIVersion != "" {
-		cfg.APIVersion = c.APIVersion
+	if isAzure(cfg.APIType) {
+		cfg.AzureModelMapperFunc = c.azureDeployment
 	}
 
 	if c.EmptyMessagesLimit > 0 {
 		cfg.EmptyMessagesLimit = c.EmptyMessagesLimit
 	}
 
+	transport := c.transport(cfg.APIType)
+	if len(c.fallbacks) > 0 {
+		transport = c.failoverTransport(cfg.BaseURL, transport)
+	}
+
+	cfg.HTTPClient = &http.Client{Timeout: time.Duration(c.Timeout), Transport: transport}
+
+	return openai.NewClientWithConfig(cfg)
+}
+
+// apiVersion returns the configured api version or the default for the api
+// type, if it has one.
+func (c *EndpointConfig) apiVersion() string {
+	switch {
+	case c.APIVersion != "":
+		return c.APIVersion
+	case c.APIType == openai.APITypeAnthropic:
+		return anthropic.DefaultVersion
+	case isAzure(c.apiType()):
+		return defaultAzureAPIVersion
+	}
+	return ""
+}
+
+// baseURL returns the configured base url or the default for the api type.
+func (c *EndpointConfig) baseURL() string {
+	switch {
+	case c.BaseURL != "":
+		return c.BaseURL
+	case c.APIType == openai.APITypeAnthropic:
+		return anthropic.DefaultBaseURL
+	case c.APIType == gemini.APIType:
+		return gemini.DefaultBaseURL
+	case c.APIType == ollama.APIType:
+		return ollama.DefaultBaseURL
+	}
+	return openai.DefaultConfig("").BaseURL
+}
+
+// transport returns the transport for requests to the endpoint.
+func (c *EndpointConfig) transport(apiType openai.APIType) http.RoundTripper {
 	tlsConfig := &tls.Config{
 		//nolint: gosec // allow _explicit_ user configured skipping
 		InsecureSkipVerify: c.InsecureSkipTLS,
@@ -109,16 +257,54 @@ func (c *EndpointConfig) NewClient() *openai.Client {
 		tlsConfig.RootCAs = rootCAs
 	}
 
-	var transport http.RoundTripper
-	transport = &http.Transport{TLSClientConfig: tlsConfig}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		tlsConfig.GetClientCertificate = c.clientCertificate()
+	}
+
+	// the default transport has the timeouts for establishing connections
+	// that a bare transport lacks
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.Proxy = c.proxy()
+	httpTransport.TLSClientConfig = tlsConfig
+
+	var transport http.RoundTripper = httpTransport
+
+	if c.FirstTokenTimeout > 0 {
+		transport = &firstTokenTransport{timeout: time.Duration(c.FirstTokenTimeout), wrapped: transport}
+	}
 
 	if log.Trace().Enabled() {
 		transport = &loggingTransport{wrapped: transport}
 	}
 
-	cfg.HTTPClient = &http.Client{Transport: transport}
+	if c.Retry != nil {
+		transport = c.Retry.retryTransport(transport)
+	}
 
-	return openai.NewClientWithConfig(cfg)
+	switch apiType {
+	case openai.APITypeAnthropic:
+		transport = anthropic.NewTransport(transport)
+	case gemini.APIType:
+		transport = gemini.NewTransport(transport)
+	case ollama.APIType:
+		transport = ollama.NewTransport(transport, c.OllamaOptions)
+	}
+
+	if len(c.Headers) > 0 {
+		transport = &headerTransport{headers: c.Headers, wrapped: transport}
+	}
+
+	// the token is resolved for each request rather than when the client is
+	// created. the logging transport redacts it.
+	if source := c.tokenSource(); source != nil {
+		transport = &authTransport{
+			apiType: apiType,
+			source:  source,
+			wrapped: transport,
+		}
+	}
+
+	return transport
 }
 
 func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
@@ -129,7 +315,16 @@ func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		log.Trace().Msg("to dump request/response body content, set env HTTP_CLIENT_DUMP_BODY=1")
 	}
 
-	req, _ := httputil.DumpRequestOut(r, dumpBody)
+	// dump a copy whose credentials are redacted. dumping the body replaces
+	// it with an unread copy which the request must then send.
+	dumped := r.Clone(r.Context())
+	for _, name := range credentialHeaders {
+		if dumped.Header.Get(name) != "" {
+			dumped.Header.Set(name, redacted)
+		}
+	}
+	req, _ := httputil.DumpRequestOut(dumped, dumpBody)
+	r.Body = dumped.Body
 	log.Trace().Bytes("request", req).Msg("request")
 
 	transport := s.wrapped
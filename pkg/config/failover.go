@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pastdev/askai/pkg/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// FallbackConfig is an endpoint to try when a request fails to connect or is
+// answered with a 429 or 5xx status. The path of the request is preserved so
+// fallbacks should be OpenAI compatible endpoints, or translated by their
+// api type. Fallbacks of azure endpoints must be azure endpoints, and those
+// of other endpoints must not be, the deployment of their requests is that
+// of the mapped model.
+type FallbackConfig struct {
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Model replaces the model of requests sent to the fallback unless the
+	// model is mapped by Models.
+	Model string `json:"model" yaml:"model"`
+	// Models maps the model of a request to the model to use on the
+	// fallback.
+	Models map[string]string `json:"models" yaml:"models"`
+}
+
+// fallback is a FallbackConfig resolved to its endpoint.
+type fallback struct {
+	FallbackConfig
+	endpoint *EndpointConfig
+}
+
+// failoverTarget is an endpoint the failover transport sends requests to.
+type failoverTarget struct {
+	baseURL string
+	// fallback is nil for the primary endpoint whose requests are sent as is.
+	fallback  *fallback
+	name      string
+	transport http.RoundTripper
+}
+
+// failoverTransport sends requests to each of its targets in turn until one
+// answers.
+type failoverTransport struct {
+	baseURL string
+	targets []failoverTarget
+}
+
+// failoverTransport wraps transport, used for requests to baseURL, to fail
+// over to the fallbacks of the endpoint.
+func (c *EndpointConfig) failoverTransport(baseURL string, transport http.RoundTripper) http.RoundTripper {
+	t := failoverTransport{
+		baseURL: baseURL,
+		targets: []failoverTarget{{baseURL: baseURL, name: c.name, transport: transport}},
+	}
+	for i := range c.fallbacks {
+		fb := &c.fallbacks[i]
+		t.targets = append(t.targets, failoverTarget{
+			baseURL:   fb.endpoint.baseURL(),
+			fallback:  fb,
+			name:      fb.Endpoint,
+			transport: fb.endpoint.transport(fb.endpoint.apiType()),
+		})
+	}
+	return &t
+}
+
+// model returns the model to use on the fallback for model.
+func (f *fallback) model(model string) string {
+	if mapped, ok := f.Models[model]; ok {
+		return mapped
+	}
+	if f.Model != "" {
+		return f.Model
+	}
+	return model
+}
+
+func (t *failoverTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failover read body: %w", err)
+		}
+	}
+
+	for i, target := range t.targets {
+		req, err := target.request(r, t.baseURL, body)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := target.transport.RoundTrip(req)
+		last := i == len(t.targets)-1
+		if r.Context().Err() != nil || last || !shouldFailover(resp, err) {
+			if i > 0 && err == nil {
+				log.Info().Str("endpoint", target.name).Msg("answered by fallback endpoint")
+			}
+			return resp, err
+		}
+
+		event := log.Warn().Str("endpoint", target.name).Str("next", t.targets[i+1].name)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		event.Msg("endpoint failed, trying next")
+	}
+
+	// unreachable as the last target always returns
+	return nil, errors.New("failover: no endpoints")
+}
+
+// request returns a copy of r, originally for baseURL, to send to the target.
+// Requests to a fallback have their model mapped and the headers of the
+// original endpoint removed, its transport authorizes them.
+func (t *failoverTarget) request(r *http.Request, baseURL string, body []byte) (*http.Request, error) {
+	req := r.Clone(r.Context())
+	if t.fallback != nil {
+		fbURL := t.baseURL + strings.TrimPrefix(r.URL.String(), baseURL)
+		var err error
+		req.URL, err = req.URL.Parse(fbURL)
+		if err != nil {
+			return nil, fmt.Errorf("failover %s url: %w", t.name, err)
+		}
+		req.Host = req.URL.Host
+
+		var model string
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+			body, model = t.mapModel(body)
+		}
+
+		endpoint := t.fallback.endpoint
+		if isAzure(endpoint.apiType()) {
+			t.azureURL(req.URL, model)
+		}
+		req.Header.Del("Authorization")
+		req.Header.Del(openai.AzureAPIKeyHeader)
+		req.Header.Del("OpenAI-Organization")
+		req.Header.Del("anthropic-version")
+		if endpoint.OrgID != "" {
+			req.Header.Set("OpenAI-Organization", endpoint.OrgID)
+		}
+	}
+
+	if r.Body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	return req, nil
+}
+
+// azureURL sets the deployment in the path of u, if it has one, to that of
+// model and the api-version to that of the fallback.
+func (t *failoverTarget) azureURL(u *url.URL, model string) {
+	endpoint := t.fallback.endpoint
+	prefix, rest, ok := strings.Cut(u.Path, "/openai/deployments/")
+	if ok && model != "" {
+		_, operation, _ := strings.Cut(rest, "/")
+		u.Path = prefix + "/openai/deployments/" + endpoint.azureDeployment(model) + "/" + operation
+		u.RawPath = ""
+	}
+
+	query := u.Query()
+	query.Set("api-version", endpoint.apiVersion())
+	u.RawQuery = query.Encode()
+}
+
+// mapModel returns body with its model mapped for the fallback, or body as is
+// if it is not a json object or the model is unchanged, along with the mapped
+// model.
+func (t *failoverTarget) mapModel(body []byte) ([]byte, string) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return body, ""
+	}
+
+	var model string
+	_ = json.Unmarshal(fields["model"], &model)
+	mapped := t.fallback.model(model)
+	if mapped == model {
+		return body, model
+	}
+
+	fields["model"], err = json.Marshal(mapped)
+	if err != nil {
+		return body, model
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return body, model
+	}
+	return data, mapped
+}
+
+// shouldFailover returns true if the request failed to connect or the
+// endpoint is overloaded or broken.
+func shouldFailover(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,181 @@
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedRequest struct {
+	authorization string
+	model         string
+}
+
+func newChatServer(t *testing.T, status int, requests *[]recordedRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*requests = append(*requests, recordedRequest{
+			authorization: r.Header.Get("Authorization"),
+			model:         req.Model,
+		})
+
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":"from %s"}}]}`, req.Model)
+		} else {
+			_, _ = fmt.Fprint(w, `{"error":{"message":"unavailable"}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFailover(t *testing.T) {
+	tester := func(
+		t *testing.T,
+		primaryStatus int,
+		expectedContent string,
+		expectedPrimary []recordedRequest,
+		expectedFallback []recordedRequest,
+	) {
+		var primaryRequests []recordedRequest
+		var fallbackRequests []recordedRequest
+		primary := newChatServer(t, primaryStatus, &primaryRequests)
+		if primaryStatus == 0 {
+			// nothing listening
+			primary.Close()
+		}
+		fallback := newChatServer(t, http.StatusOK, &fallbackRequests)
+
+		cfg := config.Config{
+			Endpoints: map[string]config.EndpointConfig{
+				"ollama": {
+					BaseURL: primary.URL + "/v1",
+					Fallbacks: []config.FallbackConfig{
+						{Endpoint: "cloud", Models: map[string]string{"mistral": "mistral-large"}},
+					},
+				},
+				"cloud": {
+					AuthToken: "cloud-token",
+					BaseURL:   fallback.URL + "/v1",
+				},
+			},
+		}
+		endpoint, err := cfg.EndpointConfig("ollama")
+		require.NoError(t, err)
+
+		resp, err := endpoint.NewClient().CreateChatCompletion(
+			context.Background(),
+			openai.ChatCompletionRequest{Model: "mistral"})
+		require.NoError(t, err)
+		require.Equal(t, expectedContent, resp.Choices[0].Message.Content)
+		require.Equal(t, expectedPrimary, primaryRequests)
+		require.Equal(t, expectedFallback, fallbackRequests)
+	}
+
+	t.Run("primary answers", func(t *testing.T) {
+		tester(t, http.StatusOK, "from mistral", []recordedRequest{{model: "mistral"}}, nil)
+	})
+	t.Run("server error", func(t *testing.T) {
+		tester(
+			t,
+			http.StatusServiceUnavailable,
+			"from mistral-large",
+			[]recordedRequest{{model: "mistral"}},
+			[]recordedRequest{{authorization: "Bearer cloud-token", model: "mistral-large"}})
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		tester(
+			t,
+			http.StatusTooManyRequests,
+			"from mistral-large",
+			[]recordedRequest{{model: "mistral"}},
+			[]recordedRequest{{authorization: "Bearer cloud-token", model: "mistral-large"}})
+	})
+	t.Run("connection refused", func(t *testing.T) {
+		tester(
+			t,
+			0,
+			"from mistral-large",
+			nil,
+			[]recordedRequest{{authorization: "Bearer cloud-token", model: "mistral-large"}})
+	})
+}
+
+func TestFailoverNotConfigured(t *testing.T) {
+	cfg := config.Config{
+		Endpoints: map[string]config.EndpointConfig{
+			"ollama": {Fallbacks: []config.FallbackConfig{{Endpoint: "missing"}}},
+		},
+	}
+	_, err := cfg.EndpointConfig("ollama")
+	require.EqualError(t, err, "endpoint ollama fallback missing not configured")
+}
+
+func TestFailoverAzure(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/openai/deployments/mistral/chat/completions", r.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprint(w, `{"error":{"message":"unavailable"}}`)
+	}))
+	t.Cleanup(primary.Close)
+
+	var received *http.Request
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		_, _ = fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	t.Cleanup(fallback.Close)
+
+	cfg := config.Config{
+		Endpoints: map[string]config.EndpointConfig{
+			"east": {
+				APIType:   openai.APITypeAzure,
+				AuthToken: "east-key",
+				BaseURL:   primary.URL,
+				Fallbacks: []config.FallbackConfig{
+					{Endpoint: "west", Models: map[string]string{"mistral": "gpt-4o"}},
+				},
+			},
+			"west": {
+				APIType:          openai.APITypeAzure,
+				APIVersion:       "2025-01-01-preview",
+				AuthToken:        "west-key",
+				AzureDeployments: map[string]string{"gpt-4o": "gpt4o-prod"},
+				BaseURL:          fallback.URL,
+			},
+		},
+	}
+	endpoint, err := cfg.EndpointConfig("east")
+	require.NoError(t, err)
+
+	_, err = endpoint.NewClient().CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{Model: "mistral"})
+	require.NoError(t, err)
+	require.NotNil(t, received)
+	require.Equal(t, "/openai/deployments/gpt4o-prod/chat/completions", received.URL.Path)
+	require.Equal(t, "2025-01-01-preview", received.URL.Query().Get("api-version"))
+	require.Equal(t, "west-key", received.Header.Get(openai.AzureAPIKeyHeader))
+}
+
+func TestFailoverAzureMismatch(t *testing.T) {
+	cfg := config.Config{
+		Endpoints: map[string]config.EndpointConfig{
+			"azure":  {APIType: openai.APITypeAzure, Fallbacks: []config.FallbackConfig{{Endpoint: "ollama"}}},
+			"ollama": {Fallbacks: []config.FallbackConfig{{Endpoint: "azure"}}},
+		},
+	}
+	_, err := cfg.EndpointConfig("azure")
+	require.EqualError(t, err, "endpoint azure fallback ollama must be azure if and only if the endpoint is")
+	_, err = cfg.EndpointConfig("ollama")
+	require.EqualError(t, err, "endpoint ollama fallback azure must be azure if and only if the endpoint is")
+}
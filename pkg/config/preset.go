@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"dario.cat/mergo"
+	"github.com/sashabaranov/go-openai"
+)
+
+// PresetConfig is a named combination of an endpoint and request settings,
+// for example:
+//
+//	presets:
+//	  reviewer:
+//	    description: careful code review
+//	    endpoint: claude
+//	    request:
+//	      model: claude-sonnet-4-5
+//	      temperature: 0.2
+//	      messages:
+//	      - role: system
+//	        content: you are a meticulous code reviewer
+//
+// Settings are applied in order of precedence: the chat completion defaults
+// of the endpoint, then the preset, then command line flags.
+type PresetConfig struct {
+	Description string `json:"description" yaml:"description"`
+	// Endpoint is used unless one is selected with --endpoint, if it is empty
+	// the default endpoint is used.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Request is a partial request whose settings take precedence over the
+	// chat completion defaults of the endpoint. Its messages, if any, replace
+	// those of the defaults.
+	Request openai.ChatCompletionRequest `json:"request" yaml:"request"`
+	// ResponseSchema is a json schema responses must conform to. It sets the
+	// response format of the request, whose schema cannot be loaded from
+	// config.
+	ResponseSchema any `json:"response_schema" yaml:"response_schema"`
+}
+
+func (c *Config) Preset(name string) (*PresetConfig, error) {
+	preset, ok := c.Presets[name]
+	if !ok {
+		return nil, fmt.Errorf("preset %s not configured", name)
+	}
+	return &preset, nil
+}
+
+// ChatCompletionDefaults returns defaults with the settings of the preset
+// applied.
+func (p *PresetConfig) ChatCompletionDefaults(
+	defaults openai.ChatCompletionRequest,
+) (openai.ChatCompletionRequest, error) {
+	req := p.Request
+	req.Messages = slices.Clone(req.Messages)
+
+	if p.ResponseSchema != nil {
+		schema, err := json.Marshal(p.ResponseSchema)
+		if err != nil {
+			return req, fmt.Errorf("preset response schema: %w", err)
+		}
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "response",
+				Schema: json.RawMessage(schema),
+				Strict: true,
+			},
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		}
+	}
+
+	// fields the preset does not set, including messages, are filled in from
+	// the defaults
+	err := mergo.Merge(&req, defaults)
+	if err != nil {
+		return req, fmt.Errorf("preset apply defaults: %w", err)
+	}
+	return req, nil
+}
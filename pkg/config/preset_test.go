@@ -0,0 +1,79 @@
+package config_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresetChatCompletionDefaults(t *testing.T) {
+	generic := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "be helpful"}
+	reviewer := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "review carefully"}
+	defaults := openai.ChatCompletionRequest{
+		MaxTokens:   250,
+		Messages:    []openai.ChatCompletionMessage{generic},
+		Model:       "mistral",
+		Temperature: 0.7,
+	}
+
+	tester := func(t *testing.T, preset config.PresetConfig, expected openai.ChatCompletionRequest) {
+		actual, err := preset.ChatCompletionDefaults(defaults)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		tester(t, config.PresetConfig{}, defaults)
+	})
+	t.Run("overrides", func(t *testing.T) {
+		tester(
+			t,
+			config.PresetConfig{
+				Request: openai.ChatCompletionRequest{
+					Messages:    []openai.ChatCompletionMessage{reviewer},
+					Model:       "claude-sonnet-4-5",
+					Temperature: 0.2,
+				},
+			},
+			openai.ChatCompletionRequest{
+				MaxTokens:   250,
+				Messages:    []openai.ChatCompletionMessage{reviewer},
+				Model:       "claude-sonnet-4-5",
+				Temperature: 0.2,
+			})
+	})
+
+	t.Run("response schema", func(t *testing.T) {
+		preset := config.PresetConfig{
+			ResponseSchema: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"summary": map[string]any{"type": "string"}},
+			},
+		}
+		actual, err := preset.ChatCompletionDefaults(defaults)
+		require.NoError(t, err)
+		require.Equal(t, "mistral", actual.Model)
+		require.NotNil(t, actual.ResponseFormat)
+		require.Equal(t, openai.ChatCompletionResponseFormatTypeJSONSchema, actual.ResponseFormat.Type)
+
+		data, err := json.Marshal(actual.ResponseFormat.JSONSchema.Schema)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"type":"object","properties":{"summary":{"type":"string"}}}`, string(data))
+	})
+}
+
+func TestPreset(t *testing.T) {
+	cfg := config.Config{
+		Presets: map[string]config.PresetConfig{"fast": {Endpoint: "local"}},
+	}
+
+	preset, err := cfg.Preset("fast")
+	require.NoError(t, err)
+	require.Equal(t, "local", preset.Endpoint)
+
+	_, err = cfg.Preset("slow")
+	require.EqualError(t, err, "preset slow not configured")
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// PromptTemplateLeftDelim and PromptTemplateRightDelim are the delimiters
+	// of prompt templates. They differ from the text/template defaults because
+	// config values are themselves rendered as templates when loaded.
+	PromptTemplateLeftDelim  = "[["
+	PromptTemplateRightDelim = "]]"
+)
+
+// PromptConfig is a named prompt whose messages are go text/template
+// skeletons rendered with the supplied variables, for example:
+//
+//	prompts:
+//	  review:
+//	    description: review a file
+//	    system: you are an expert [[ .lang ]] developer
+//	    user: |
+//	      review this code:
+//	      [[ .file ]]
+//	    variables:
+//	      file:
+//	        required: true
+//	      lang:
+//	        default: go
+type PromptConfig struct {
+	Description string                    `json:"description" yaml:"description"`
+	System      string                    `json:"system" yaml:"system"`
+	User        string                    `json:"user" yaml:"user"`
+	Variables   map[string]PromptVariable `json:"variables" yaml:"variables"`
+}
+
+// PromptVariable describes a variable used by a prompt template.
+type PromptVariable struct {
+	Default     string `json:"default" yaml:"default"`
+	Description string `json:"description" yaml:"description"`
+	Required    bool   `json:"required" yaml:"required"`
+}
+
+func (c *Config) Prompt(name string) (*PromptConfig, error) {
+	prompt, ok := c.Prompts[name]
+	if !ok {
+		return nil, fmt.Errorf("prompt %s not configured", name)
+	}
+	return &prompt, nil
+}
+
+// Messages renders the prompt with vars returning a system message and a user
+// message for each that is configured. An error is returned if a required
+// variable is not supplied or the templates reference an unknown variable.
+func (p PromptConfig) Messages(vars map[string]string) ([]openai.ChatCompletionMessage, error) {
+	data := make(map[string]string, len(p.Variables)+len(vars))
+	var missing []string
+	for name, variable := range p.Variables {
+		_, supplied := vars[name]
+		switch {
+		case supplied:
+		case variable.Required:
+			missing = append(missing, name)
+		default:
+			data[name] = variable.Default
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return nil, fmt.Errorf("missing required variables: %s", strings.Join(missing, ", "))
+	}
+	for name, value := range vars {
+		data[name] = value
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, 2)
+	for _, part := range []struct {
+		role string
+		text string
+	}{
+		{role: openai.ChatMessageRoleSystem, text: p.System},
+		{role: openai.ChatMessageRoleUser, text: p.User},
+	} {
+		if part.text == "" {
+			continue
+		}
+
+		content, err := renderPromptTemplate(part.role, part.text, data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(
+			messages,
+			openai.ChatCompletionMessage{Role: part.role, Content: content})
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.New("prompt has no system or user message")
+	}
+
+	return messages, nil
+}
+
+func renderPromptTemplate(name string, text string, data map[string]string) (string, error) {
+	tmpl, err := template.New(name).
+		Delims(PromptTemplateLeftDelim, PromptTemplateRightDelim).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse %s template: %w", name, err)
+	}
+
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
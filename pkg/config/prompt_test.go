@@ -0,0 +1,73 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptMessages(t *testing.T) {
+	prompt := config.PromptConfig{
+		System: "you are an expert [[ .lang ]] developer",
+		User:   "review this code:\n[[ .file ]]",
+		Variables: map[string]config.PromptVariable{
+			"file": {Required: true},
+			"lang": {Default: "go"},
+		},
+	}
+
+	tester := func(
+		t *testing.T,
+		prompt config.PromptConfig,
+		vars map[string]string,
+		expected []openai.ChatCompletionMessage,
+		expectedErr string,
+	) {
+		messages, err := prompt.Messages(vars)
+		if expectedErr != "" {
+			require.EqualError(t, err, expectedErr)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, expected, messages)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		tester(
+			t,
+			prompt,
+			map[string]string{"file": "package main"},
+			[]openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "you are an expert go developer"},
+				{Role: openai.ChatMessageRoleUser, Content: "review this code:\npackage main"},
+			},
+			"")
+	})
+
+	t.Run("override default", func(t *testing.T) {
+		tester(
+			t,
+			prompt,
+			map[string]string{"file": "fn main() {}", "lang": "rust"},
+			[]openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "you are an expert rust developer"},
+				{Role: openai.ChatMessageRoleUser, Content: "review this code:\nfn main() {}"},
+			},
+			"")
+	})
+
+	t.Run("missing required", func(t *testing.T) {
+		tester(t, prompt, nil, nil, "missing required variables: file")
+	})
+
+	t.Run("undeclared variable", func(t *testing.T) {
+		tester(
+			t,
+			config.PromptConfig{User: "hello [[ .name ]]"},
+			nil,
+			nil,
+			`render user template: template: user:1:9: executing "user" at <.name>: map has no entry for key "name"`)
+	})
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pastdev/askai/pkg/log"
+)
+
+const (
+	// statusOverloaded is used by anthropic when it is temporarily overloaded.
+	statusOverloaded = 529
+
+	defaultRetryBaseDelay   = time.Second
+	defaultRetryMaxAttempts = 3
+	defaultRetryMaxDelay    = 30 * time.Second
+)
+
+// RetryConfig configures retrying requests that are rate limited (429), fail
+// with a transient server error (502, 503, 504 or 529, and 500 for idempotent
+// requests), or fail to connect.
+// The delay between attempts doubles each time unless the response says how
+// long to wait using Retry-After or x-ratelimit-reset-* headers. Only the
+// status of a response is used to decide whether to retry, once a successful
+// response has been returned it is never retried, so a stream that has
+// started is not repeated.
+type RetryConfig struct {
+	// BaseDelay is the delay before the first retry, 1s by default.
+	BaseDelay Duration `json:"base_delay" yaml:"base_delay"`
+	// Jitter is the fraction, between 0 and 1, the delay is randomly varied
+	// by so that many clients do not retry in lock step.
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+	// MaxAttempts is the most times a request is sent, including the first,
+	// 3 by default.
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+	// MaxDelay is the longest delay between attempts, 30s by default. If the
+	// endpoint asks to wait longer, the request is not retried.
+	MaxDelay Duration `json:"max_delay" yaml:"max_delay"`
+}
+
+type retryTransport struct {
+	baseDelay   time.Duration
+	jitter      float64
+	maxAttempts int
+	maxDelay    time.Duration
+	wrapped     http.RoundTripper
+}
+
+// retryTransport wraps transport to retry as configured.
+func (c *RetryConfig) retryTransport(transport http.RoundTripper) http.RoundTripper {
+	t := retryTransport{
+		baseDelay:   time.Duration(c.BaseDelay),
+		jitter:      min(max(c.Jitter, 0), 1),
+		maxAttempts: c.MaxAttempts,
+		maxDelay:    time.Duration(c.MaxDelay),
+		wrapped:     transport,
+	}
+	if t.baseDelay <= 0 {
+		t.baseDelay = defaultRetryBaseDelay
+	}
+	if t.maxAttempts <= 0 {
+		t.maxAttempts = defaultRetryMaxAttempts
+	}
+	if t.maxDelay <= 0 {
+		t.maxDelay = defaultRetryMaxDelay
+	}
+	return &t
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req := r
+		if attempt > 1 {
+			req = r.Clone(r.Context())
+			if r.Body != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("retry body: %w", err)
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err := t.wrapped.RoundTrip(req)
+		if attempt >= t.maxAttempts || !retryable(r, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := t.delay(attempt, resp)
+		if !ok {
+			log.Debug().Dur("delay", delay).Msg("requested retry delay exceeds max delay, not retrying")
+			return resp, err
+		}
+
+		event := log.Warn().Int("attempt", attempt).Dur("delay", delay)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+			_ = resp.Body.Close()
+		}
+		event.Msg("request failed, retrying")
+
+		err = sleep(r.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// delay returns how long to wait before attempt+1. If the response asks for
+// a delay longer than the max delay, false is returned.
+func (t *retryTransport) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if requested, ok := requestedDelay(resp); ok {
+		return requested, requested <= t.maxDelay
+	}
+
+	delay := t.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > t.maxDelay {
+		// the shift overflowed or passed the max
+		delay = t.maxDelay
+	}
+	if t.jitter > 0 {
+		//nolint: gosec // jitter does not need a secure random number
+		delay = time.Duration(float64(delay) * (1 + t.jitter*(2*rand.Float64()-1)))
+	}
+	return delay, true
+}
+
+// requestedDelay returns the delay the response asks for using the
+// Retry-After, retry-after-ms, or x-ratelimit-reset-* headers.
+func requestedDelay(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	if ms, err := strconv.ParseFloat(resp.Header.Get("Retry-After-Ms"), 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return max(0, time.Until(at)), true
+		}
+	}
+
+	// openai reports when each of its limits resets as a duration like 6m0s,
+	// the request must wait for whichever is later
+	var reset time.Duration
+	found := false
+	for _, header := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if d, err := time.ParseDuration(resp.Header.Get(header)); err == nil {
+			reset = max(reset, d)
+			found = true
+		}
+	}
+	return reset, found
+}
+
+// retryable returns true if the request can be sent again. Requests are only
+// retried if they can be replayed and either the endpoint did not process
+// them (connection failures and 429) or retrying is harmless.
+func retryable(r *http.Request, resp *http.Response, err error) bool {
+	if r.Context().Err() != nil {
+		return false
+	}
+	if r.Body != nil && r.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		// the request may have been processed, so only retry if that is
+		// harmless
+		return idempotent(r)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError:
+		// the request may have been processed before the error
+		return idempotent(r)
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		statusOverloaded:
+		return true
+	}
+	return false
+}
+
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodPut:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("retry: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
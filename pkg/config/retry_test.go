@@ -0,0 +1,138 @@
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	type failure struct {
+		header http.Header
+		status int
+	}
+
+	tester := func(
+		t *testing.T,
+		retry *config.RetryConfig,
+		headers map[string]string,
+		failures []failure,
+		expectedAttempts int,
+		expectedStatus int,
+	) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			attempts++
+			if attempts <= len(failures) {
+				for k, v := range failures[attempts-1].header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(failures[attempts-1].status)
+				_, _ = fmt.Fprint(w, `{"error":{"message":"try again"}}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+		}))
+		defer server.Close()
+
+		endpoint := config.EndpointConfig{BaseURL: server.URL, Headers: headers, Retry: retry}
+		_, err := endpoint.NewClient().CreateChatCompletion(
+			context.Background(),
+			openai.ChatCompletionRequest{Model: "test"})
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, err)
+		} else {
+			var apiErr *openai.APIError
+			require.ErrorAs(t, err, &apiErr)
+			require.Equal(t, expectedStatus, apiErr.HTTPStatusCode)
+		}
+		require.Equal(t, expectedAttempts, attempts)
+	}
+
+	fast := &config.RetryConfig{
+		BaseDelay: config.Duration(time.Millisecond),
+		Jitter:    0.5,
+		MaxDelay:  config.Duration(10 * time.Millisecond),
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		tester(t, nil, nil, []failure{{status: http.StatusBadGateway}}, 1, http.StatusBadGateway)
+	})
+	t.Run("transient", func(t *testing.T) {
+		tester(
+			t,
+			fast,
+			nil,
+			[]failure{{status: http.StatusBadGateway}, {status: http.StatusServiceUnavailable}},
+			3,
+			http.StatusOK)
+	})
+	t.Run("max attempts", func(t *testing.T) {
+		tester(
+			t,
+			fast,
+			nil,
+			[]failure{{status: http.StatusBadGateway}, {status: http.StatusBadGateway}, {status: http.StatusBadGateway}},
+			3,
+			http.StatusBadGateway)
+	})
+	t.Run("server error", func(t *testing.T) {
+		// a chat completion post may have been processed before the error
+		tester(t, fast, nil, []failure{{status: http.StatusInternalServerError}}, 1, http.StatusInternalServerError)
+	})
+	t.Run("idempotent server error", func(t *testing.T) {
+		tester(
+			t,
+			fast,
+			map[string]string{"Idempotency-Key": "abc"},
+			[]failure{{status: http.StatusInternalServerError}},
+			2,
+			http.StatusOK)
+	})
+	t.Run("not retryable", func(t *testing.T) {
+		tester(t, fast, nil, []failure{{status: http.StatusBadRequest}}, 1, http.StatusBadRequest)
+	})
+	t.Run("retry after", func(t *testing.T) {
+		tester(
+			t,
+			fast,
+			nil,
+			[]failure{
+				{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"0"}}},
+				{status: http.StatusTooManyRequests, header: http.Header{"Retry-After-Ms": {"5"}}},
+			},
+			3,
+			http.StatusOK)
+	})
+	t.Run("ratelimit reset", func(t *testing.T) {
+		tester(
+			t,
+			fast,
+			nil,
+			[]failure{{
+				status: http.StatusTooManyRequests,
+				header: http.Header{
+					"X-Ratelimit-Reset-Requests": {"1ms"},
+					"X-Ratelimit-Reset-Tokens":   {"5ms"},
+				},
+			}},
+			2,
+			http.StatusOK)
+	})
+	t.Run("retry after exceeds max delay", func(t *testing.T) {
+		tester(
+			t,
+			fast,
+			nil,
+			[]failure{{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"60"}}}},
+			1,
+			http.StatusTooManyRequests)
+	})
+}
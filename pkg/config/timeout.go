@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// firstTokenTransport fails requests whose response does not start within
+// timeout. For streamed responses that is the first chunk, for others the
+// whole response.
+type firstTokenTransport struct {
+	timeout time.Duration
+	wrapped http.RoundTripper
+}
+
+// firstTokenBody stops the timer of its request on the first read of any
+// content.
+type firstTokenBody struct {
+	cancel  context.CancelCauseFunc
+	ctx     context.Context
+	once    sync.Once
+	timer   *time.Timer
+	wrapped io.ReadCloser
+}
+
+// firstTokenTimeoutError is the cause of requests cancelled by a
+// firstTokenTransport.
+type firstTokenTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *firstTokenTimeoutError) Error() string {
+	return fmt.Sprintf("no response within first token timeout of %s", e.timeout)
+}
+
+func (t *firstTokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(r.Context())
+	timer := time.AfterFunc(t.timeout, func() {
+		cancel(&firstTokenTimeoutError{timeout: t.timeout})
+	})
+
+	resp, err := t.wrapped.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		timer.Stop()
+		cause := context.Cause(ctx)
+		cancel(nil)
+		if _, ok := cause.(*firstTokenTimeoutError); ok {
+			return nil, cause
+		}
+		return nil, err
+	}
+
+	resp.Body = &firstTokenBody{cancel: cancel, ctx: ctx, timer: timer, wrapped: resp.Body}
+	return resp, nil
+}
+
+func (b *firstTokenBody) Close() error {
+	b.timer.Stop()
+	err := b.wrapped.Close()
+	b.cancel(nil)
+	return err
+}
+
+func (b *firstTokenBody) Read(p []byte) (int, error) {
+	n, err := b.wrapped.Read(p)
+	if n > 0 {
+		b.once.Do(func() { b.timer.Stop() })
+	}
+	if err != nil && err != io.EOF {
+		if cause, ok := context.Cause(b.ctx).(*firstTokenTimeoutError); ok {
+			return n, cause
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstTokenTimeout(t *testing.T) {
+	tester := func(t *testing.T, firstToken time.Duration, expectedErr string) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-time.After(firstToken):
+			case <-r.Context().Done():
+				return
+			}
+			_, _ = fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"content":"hi"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+			// later chunks are not subject to the timeout
+			time.Sleep(100 * time.Millisecond)
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		endpoint := config.EndpointConfig{
+			BaseURL:           server.URL,
+			FirstTokenTimeout: config.Duration(50 * time.Millisecond),
+		}
+		stream, err := endpoint.NewClient().CreateChatCompletionStream(
+			context.Background(),
+			openai.ChatCompletionRequest{Model: "test", Stream: true})
+		require.NoError(t, err)
+		defer func() { _ = stream.Close() }()
+
+		_, err = stream.Recv()
+		if expectedErr != "" {
+			require.ErrorContains(t, err, expectedErr)
+			return
+		}
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Error(t, err, "expected end of stream")
+		require.NotContains(t, err.Error(), "first token timeout")
+	}
+
+	t.Run("first chunk in time", func(t *testing.T) {
+		tester(t, 0, "")
+	})
+	t.Run("first chunk late", func(t *testing.T) {
+		tester(t, time.Second, "no response within first token timeout of 50ms")
+	})
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// pemPrefix starts a pem encoded value, values that do not contain one are
+// file paths.
+const pemPrefix = "-----BEGIN"
+
+type headerTransport struct {
+	headers map[string]string
+	wrapped http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for name, value := range t.headers {
+		r.Header.Set(name, value)
+	}
+	return t.wrapped.RoundTrip(r)
+}
+
+// clientCertificate returns a function that presents the configured client
+// certificate. If it cannot be loaded the error is reported by the tls
+// handshake of every request rather than silently connecting without it.
+func (c *EndpointConfig) clientCertificate() func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := c.loadClientCertificate()
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
+	}
+}
+
+func (c *EndpointConfig) loadClientCertificate() (tls.Certificate, error) {
+	if c.ClientCert == "" || c.ClientKey == "" {
+		return tls.Certificate{}, errors.New("client_cert and client_key must both be set")
+	}
+
+	certPEM, err := readPEM(c.ClientCert)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client cert: %w", err)
+	}
+	keyPEM, err := readPEM(string(c.ClientKey))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client key: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client cert: %w", err)
+	}
+	return cert, nil
+}
+
+// proxy returns the proxy function of the transport. Unless a proxy url is
+// configured, the environment (HTTPS_PROXY, HTTP_PROXY and NO_PROXY) is used.
+func (c *EndpointConfig) proxy() func(*http.Request) (*url.URL, error) {
+	if c.ProxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err == nil && proxyURL.Host == "" {
+		err = errors.New("missing host")
+	}
+	if err != nil {
+		// fail the request rather than bypass the proxy
+		return func(*http.Request) (*url.URL, error) {
+			return nil, fmt.Errorf("proxy url %s: %w", c.ProxyURL, err)
+		}
+	}
+	return http.ProxyURL(proxyURL)
+}
+
+// readPEM returns value if it is pem encoded, otherwise the content of the
+// file it names.
+func readPEM(value string) ([]byte, error) {
+	if strings.Contains(value, pemPrefix) {
+		return []byte(value), nil
+	}
+
+	file, err := expandHome(value)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint: gosec // the intent is to read the user configured file
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	return data, nil
+}
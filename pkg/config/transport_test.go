@@ -0,0 +1,151 @@
+package config_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/pastdev/askai/pkg/log"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// newCertificate returns a pem encoded self signed client certificate and its
+// key.
+func newCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "askai"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func listModels(t *testing.T, endpoint config.EndpointConfig) error {
+	_, err := endpoint.NewClient().ListModels(context.Background())
+	return err
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert, key := newCertificate(t)
+	keyFile := filepath.Join(t.TempDir(), "client.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(key), 0o600))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Len(t, r.TLS.PeerCertificates, 1)
+		require.Equal(t, "askai", r.TLS.PeerCertificates[0].Subject.CommonName)
+		_, _ = fmt.Fprint(w, `{"data":[]}`)
+	}))
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM([]byte(cert)))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	serverCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	endpoint := config.EndpointConfig{BaseURL: server.URL, CACerts: serverCert}
+
+	t.Run("without certificate", func(t *testing.T) {
+		require.Error(t, listModels(t, endpoint))
+	})
+	t.Run("with certificate", func(t *testing.T) {
+		endpoint := endpoint
+		endpoint.ClientCert = cert
+		endpoint.ClientKey = config.Secret(keyFile)
+		require.NoError(t, listModels(t, endpoint))
+	})
+	t.Run("missing key", func(t *testing.T) {
+		endpoint := endpoint
+		endpoint.ClientCert = cert
+		require.ErrorContains(t, listModels(t, endpoint), "client_cert and client_key must both be set")
+	})
+}
+
+func TestHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "tenant-1", r.Header.Get("X-Tenant-Id"))
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_, _ = fmt.Fprint(w, `{"data":[]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	require.NoError(t, listModels(t, config.EndpointConfig{
+		AuthToken: "secret",
+		BaseURL:   server.URL,
+		Headers:   map[string]string{"X-Tenant-Id": "tenant-1"},
+	}))
+}
+
+func TestLoggingRedactsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+		_, _ = fmt.Fprint(w, `{"data":[]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	var trace strings.Builder
+	logger := log.Logger
+	log.Logger = zerolog.New(&trace).Level(zerolog.TraceLevel)
+	t.Cleanup(func() { log.Logger = logger })
+
+	require.NoError(t, listModels(t, config.EndpointConfig{
+		AuthToken: "secret-token",
+		BaseURL:   server.URL,
+	}))
+	require.Contains(t, trace.String(), "Authorization: REDACTED")
+	require.NotContains(t, trace.String(), "secret-token")
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = fmt.Fprint(w, `{"data":[]}`)
+	}))
+	t.Cleanup(proxy.Close)
+
+	t.Run("configured", func(t *testing.T) {
+		proxied = nil
+		require.NoError(t, listModels(t, config.EndpointConfig{
+			BaseURL:  "http://llm.internal/v1",
+			ProxyURL: proxy.URL,
+		}))
+		require.Equal(t, []string{"http://llm.internal/v1/models"}, proxied)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		require.ErrorContains(t, listModels(t, config.EndpointConfig{
+			BaseURL:  "http://llm.internal/v1",
+			ProxyURL: "llm-proxy:3128",
+		}), "proxy url llm-proxy:3128")
+	})
+}
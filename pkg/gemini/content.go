@@ -0,0 +1,420 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+// thinkingBudgets maps reasoning efforts to thinking budgets in tokens.
+var thinkingBudgets = map[string]int{
+	"none":   0,
+	"low":    1024,
+	"medium": 8192,
+	"high":   24576,
+}
+
+type candidate struct {
+	Content      content `json:"content"`
+	FinishReason string  `json:"finishReason"`
+	Index        int     `json:"index"`
+}
+
+type content struct {
+	Parts []part `json:"parts"`
+	Role  string `json:"role,omitempty"`
+}
+
+type functionCall struct {
+	Args json.RawMessage `json:"args,omitempty"`
+	Name string          `json:"name"`
+}
+
+type functionCallingConfig struct {
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	Mode                 string   `json:"mode"`
+}
+
+type functionDeclaration struct {
+	Description          string `json:"description,omitempty"`
+	Name                 string `json:"name"`
+	ParametersJSONSchema any    `json:"parametersJsonSchema,omitempty"`
+}
+
+type functionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type generateContentRequest struct {
+	Contents          []content         `json:"contents"`
+	GenerationConfig  *generationConfig `json:"generationConfig,omitempty"`
+	SystemInstruction *content          `json:"systemInstruction,omitempty"`
+	ToolConfig        *toolConfig       `json:"toolConfig,omitempty"`
+	Tools             []tool            `json:"tools,omitempty"`
+}
+
+type generateContentResponse struct {
+	Candidates    []candidate   `json:"candidates"`
+	ModelVersion  string        `json:"modelVersion"`
+	ResponseID    string        `json:"responseId"`
+	UsageMetadata usageMetadata `json:"usageMetadata"`
+}
+
+type generationConfig struct {
+	CandidateCount     int             `json:"candidateCount,omitempty"`
+	FrequencyPenalty   *float32        `json:"frequencyPenalty,omitempty"`
+	MaxOutputTokens    int             `json:"maxOutputTokens,omitempty"`
+	PresencePenalty    *float32        `json:"presencePenalty,omitempty"`
+	ResponseJSONSchema json.RawMessage `json:"responseJsonSchema,omitempty"`
+	ResponseMimeType   string          `json:"responseMimeType,omitempty"`
+	Seed               *int            `json:"seed,omitempty"`
+	StopSequences      []string        `json:"stopSequences,omitempty"`
+	Temperature        *float32        `json:"temperature,omitempty"`
+	ThinkingConfig     *thinkingConfig `json:"thinkingConfig,omitempty"`
+	TopP               *float32        `json:"topP,omitempty"`
+}
+
+type inlineData struct {
+	Data     string `json:"data"`
+	MimeType string `json:"mimeType"`
+}
+
+type part struct {
+	FunctionCall     *functionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *functionResponse `json:"functionResponse,omitempty"`
+	InlineData       *inlineData       `json:"inlineData,omitempty"`
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+}
+
+type thinkingConfig struct {
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+	ThinkingBudget  int  `json:"thinkingBudget"`
+}
+
+type tool struct {
+	FunctionDeclarations []functionDeclaration `json:"functionDeclarations"`
+}
+
+type toolConfig struct {
+	FunctionCallingConfig functionCallingConfig `json:"functionCallingConfig"`
+}
+
+type usageMetadata struct {
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	PromptTokenCount     int `json:"promptTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// toGenerateContentRequest converts a chat completion request to a generate
+// content request. System messages become the system instruction, the
+// assistant role becomes model, and tool results are sent as function
+// responses named after the call they answer, as gemini does not use ids.
+func toGenerateContentRequest(
+	req openai.ChatCompletionRequest,
+	format *translate.ResponseFormat,
+) (generateContentRequest, error) {
+	greq := generateContentRequest{}
+
+	config := generationConfig{
+		MaxOutputTokens: req.MaxCompletionTokens,
+		Seed:            req.Seed,
+		StopSequences:   req.Stop,
+	}
+	if config.MaxOutputTokens == 0 {
+		config.MaxOutputTokens = req.MaxTokens
+	}
+	if req.N > 1 {
+		config.CandidateCount = req.N
+	}
+	if req.Temperature != 0 {
+		config.Temperature = &req.Temperature
+	}
+	if req.TopP != 0 {
+		config.TopP = &req.TopP
+	}
+	if req.FrequencyPenalty != 0 {
+		config.FrequencyPenalty = &req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		config.PresencePenalty = &req.PresencePenalty
+	}
+	if budget, ok := thinkingBudgets[req.ReasoningEffort]; ok {
+		config.ThinkingConfig = &thinkingConfig{IncludeThoughts: budget > 0, ThinkingBudget: budget}
+	}
+	if format != nil {
+		switch {
+		case format.Type == string(openai.ChatCompletionResponseFormatTypeJSONObject):
+			config.ResponseMimeType = "application/json"
+		case format.JSONSchema != nil && len(format.JSONSchema.Schema) > 0:
+			config.ResponseMimeType = "application/json"
+			config.ResponseJSONSchema = format.JSONSchema.Schema
+		}
+	}
+	if !isZero(config) {
+		greq.GenerationConfig = &config
+	}
+
+	for _, t := range req.Tools {
+		if t.Function == nil {
+			continue
+		}
+		if len(greq.Tools) == 0 {
+			greq.Tools = []tool{{}}
+		}
+		greq.Tools[0].FunctionDeclarations = append(greq.Tools[0].FunctionDeclarations, functionDeclaration{
+			Description:          t.Function.Description,
+			Name:                 t.Function.Name,
+			ParametersJSONSchema: t.Function.Parameters,
+		})
+	}
+
+	choice, err := toToolConfig(req.ToolChoice)
+	if err != nil {
+		return greq, err
+	}
+	greq.ToolConfig = choice
+
+	var system []part
+	// function responses are identified by name rather than id
+	toolNames := map[string]string{}
+	for _, msg := range req.Messages {
+		var role string
+		var parts []part
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+			system = append(system, part{Text: translate.MessageText(msg)})
+			continue
+		case openai.ChatMessageRoleUser:
+			role = "user"
+			if len(msg.MultiContent) == 0 {
+				parts = append(parts, part{Text: msg.Content})
+			}
+			for _, p := range msg.MultiContent {
+				gp, err := toPart(p)
+				if err != nil {
+					return greq, err
+				}
+				parts = append(parts, gp)
+			}
+		case openai.ChatMessageRoleAssistant:
+			role = "model"
+			if text := translate.MessageText(msg); text != "" {
+				parts = append(parts, part{Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				args := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, part{
+					FunctionCall: &functionCall{Args: args, Name: call.Function.Name},
+				})
+			}
+		case openai.ChatMessageRoleTool:
+			role = "user"
+			name := toolNames[msg.ToolCallID]
+			if name == "" {
+				name = msg.Name
+			}
+			parts = append(parts, part{
+				FunctionResponse: &functionResponse{
+					Name:     name,
+					Response: toolResponse(translate.MessageText(msg)),
+				},
+			})
+		default:
+			return greq, fmt.Errorf("unsupported role %s", msg.Role)
+		}
+
+		// consecutive messages of the same role, such as several tool
+		// results, are sent as one content
+		if n := len(greq.Contents); n > 0 && greq.Contents[n-1].Role == role {
+			greq.Contents[n-1].Parts = append(greq.Contents[n-1].Parts, parts...)
+			continue
+		}
+		greq.Contents = append(greq.Contents, content{Parts: parts, Role: role})
+	}
+
+	if len(system) > 0 {
+		greq.SystemInstruction = &content{Parts: system}
+	}
+	return greq, nil
+}
+
+// toPart converts a part of a user message. Images must be data urls which
+// are sent inline.
+func toPart(p openai.ChatMessagePart) (part, error) {
+	switch p.Type {
+	case openai.ChatMessagePartTypeText:
+		return part{Text: p.Text}, nil
+	case openai.ChatMessagePartTypeImageURL:
+		if p.ImageURL == nil {
+			return part{}, errors.New("image part without url")
+		}
+		mediaType, data, ok := strings.Cut(strings.TrimPrefix(p.ImageURL.URL, "data:"), ";base64,")
+		if !ok || !strings.HasPrefix(p.ImageURL.URL, "data:") {
+			return part{}, errors.New("only data url images are supported")
+		}
+		return part{InlineData: &inlineData{Data: data, MimeType: mediaType}}, nil
+	}
+	return part{}, fmt.Errorf("unsupported content part type %s", p.Type)
+}
+
+// toToolConfig converts the tool choice of a chat completion request, which
+// is either a string or an openai.ToolChoice.
+func toToolConfig(choice any) (*toolConfig, error) {
+	switch c := choice.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch c {
+		case "auto":
+			return &toolConfig{FunctionCallingConfig: functionCallingConfig{Mode: "AUTO"}}, nil
+		case "none":
+			return &toolConfig{FunctionCallingConfig: functionCallingConfig{Mode: "NONE"}}, nil
+		case "required":
+			return &toolConfig{FunctionCallingConfig: functionCallingConfig{Mode: "ANY"}}, nil
+		}
+	case map[string]any:
+		if function, ok := c["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok {
+				return &toolConfig{FunctionCallingConfig: functionCallingConfig{
+					AllowedFunctionNames: []string{name},
+					Mode:                 "ANY",
+				}}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported tool choice %v", choice)
+}
+
+// toolResponse returns the response of a function response which must be a
+// json object, other content is wrapped in one.
+func toolResponse(text string) json.RawMessage {
+	var object map[string]any
+	if json.Unmarshal([]byte(text), &object) == nil && object != nil {
+		return json.RawMessage(text)
+	}
+
+	data, _ := json.Marshal(map[string]string{"result": text})
+	return data
+}
+
+// fromGenerateContentResponse converts a generate content response to a chat
+// completion response with a choice for each candidate.
+func fromGenerateContentResponse(resp generateContentResponse, model string) openai.ChatCompletionResponse {
+	result := openai.ChatCompletionResponse{
+		Choices: make([]openai.ChatCompletionChoice, 0, len(resp.Candidates)),
+		Created: time.Now().Unix(),
+		ID:      completionID(resp.ResponseID),
+		Model:   model,
+		Object:  "chat.completion",
+		Usage:   resp.UsageMetadata.openai(),
+	}
+	if resp.ModelVersion != "" {
+		result.Model = resp.ModelVersion
+	}
+
+	for _, c := range resp.Candidates {
+		text, reasoning, calls := fromParts(c.Content.Parts, 0)
+		result.Choices = append(result.Choices, openai.ChatCompletionChoice{
+			FinishReason: finishReason(c.FinishReason, len(calls) > 0),
+			Index:        c.Index,
+			Message: openai.ChatCompletionMessage{
+				Content:          text,
+				ReasoningContent: reasoning,
+				Role:             openai.ChatMessageRoleAssistant,
+				ToolCalls:        calls,
+			},
+		})
+	}
+	return result
+}
+
+// fromParts returns the text, thoughts and function calls of parts. Calls are
+// numbered from start.
+func fromParts(parts []part, start int) (string, string, []openai.ToolCall) {
+	var text, reasoning strings.Builder
+	var calls []openai.ToolCall
+	for _, p := range parts {
+		switch {
+		case p.FunctionCall != nil:
+			index := start + len(calls)
+			args := string(p.FunctionCall.Args)
+			if args == "" {
+				args = "{}"
+			}
+			calls = append(calls, openai.ToolCall{
+				Function: openai.FunctionCall{Arguments: args, Name: p.FunctionCall.Name},
+				ID:       fmt.Sprintf("call_%d", index),
+				Index:    &index,
+				Type:     openai.ToolTypeFunction,
+			})
+		case p.Thought:
+			reasoning.WriteString(p.Text)
+		default:
+			text.WriteString(p.Text)
+		}
+	}
+	return text.String(), reasoning.String(), calls
+}
+
+func completionID(responseID string) string {
+	if responseID != "" {
+		return "chatcmpl-" + responseID
+	}
+	return fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+}
+
+func finishReason(reason string, calledTools bool) openai.FinishReason {
+	switch {
+	case calledTools:
+		return openai.FinishReasonToolCalls
+	case reason == "":
+		return ""
+	case reason == "MAX_TOKENS":
+		return openai.FinishReasonLength
+	case reason == "SAFETY" || reason == "RECITATION" || reason == "BLOCKLIST" ||
+		reason == "PROHIBITED_CONTENT" || reason == "SPII":
+		return openai.FinishReasonContentFilter
+	}
+	return openai.FinishReasonStop
+}
+
+func isZero(config generationConfig) bool {
+	return config.CandidateCount == 0 &&
+		config.FrequencyPenalty == nil &&
+		config.MaxOutputTokens == 0 &&
+		config.PresencePenalty == nil &&
+		config.ResponseMimeType == "" &&
+		config.Seed == nil &&
+		len(config.StopSequences) == 0 &&
+		config.Temperature == nil &&
+		config.ThinkingConfig == nil &&
+		config.TopP == nil
+}
+
+func (u usageMetadata) openai() openai.Usage {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	total := u.TotalTokenCount
+	if total == 0 {
+		total = u.PromptTokenCount + completion
+	}
+	return openai.Usage{
+		CompletionTokens: completion,
+		CompletionTokensDetails: &openai.CompletionTokensDetails{
+			ReasoningTokens: u.ThoughtsTokenCount,
+		},
+		PromptTokens: u.PromptTokenCount,
+		TotalTokens:  total,
+	}
+}
@@ -0,0 +1,283 @@
+// Package gemini lets an openai client talk to the google gemini api by
+// translating requests and responses in its transport.
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	APIType        openai.APIType = "GEMINI"
+	DefaultBaseURL                = "https://generativelanguage.googleapis.com/v1beta"
+
+	// maxLineSize is the largest line of a streamed response that can be
+	// read.
+	maxLineSize = 16 << 20
+)
+
+// Transport translates the chat completion and model list requests of an
+// openai client to the gemini generate content api and the responses back.
+type Transport struct {
+	Wrapped http.RoundTripper
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+type modelsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+type openaiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// NewTransport returns a transport that sends translated requests using
+// wrapped.
+func NewTransport(wrapped http.RoundTripper) *Transport {
+	return &Transport{Wrapped: wrapped}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		return t.chatCompletion(r)
+	case strings.HasSuffix(r.URL.Path, "/models") && r.Method == http.MethodGet:
+		return t.models(r)
+	}
+	return nil, fmt.Errorf("gemini: %s is not supported", r.URL.Path)
+}
+
+func (t *Transport) chatCompletion(r *http.Request) (*http.Response, error) {
+	req, format, err := translate.DecodeChatRequest(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+
+	greq, err := toGenerateContentRequest(req, format)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+
+	// the model is part of the path rather than the body
+	method := ":generateContent"
+	if req.Stream {
+		method = ":streamGenerateContent"
+	}
+	out := r.Clone(r.Context())
+	out.URL.Path = strings.TrimSuffix(out.URL.Path, "/chat/completions") +
+		"/models/" + strings.TrimPrefix(req.Model, "models/") + method
+	if req.Stream {
+		query := out.URL.Query()
+		query.Set("alt", "sse")
+		out.URL.RawQuery = query.Encode()
+	}
+	err = translate.SetBody(out, greq)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	setHeaders(out)
+
+	resp, err := t.Wrapped.RoundTrip(out)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return translateError(resp)
+	}
+
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		return translate.Stream(resp, func(r io.Reader, w io.Writer) error {
+			return translateStream(r, w, req.Model, includeUsage)
+		}), nil
+	}
+
+	var gresp generateContentResponse
+	err = json.NewDecoder(resp.Body).Decode(&gresp)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gemini decode response: %w", err)
+	}
+	return translate.ReplaceBody(resp, fromGenerateContentResponse(gresp, req.Model))
+}
+
+func (t *Transport) models(r *http.Request) (*http.Response, error) {
+	out := r.Clone(r.Context())
+	setHeaders(out)
+
+	resp, err := t.Wrapped.RoundTrip(out)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return translateError(resp)
+	}
+
+	var models modelsResponse
+	err = json.NewDecoder(resp.Body).Decode(&models)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gemini decode models: %w", err)
+	}
+
+	list := openai.ModelsList{Models: make([]openai.Model, 0, len(models.Models))}
+	for _, model := range models.Models {
+		list.Models = append(list.Models, openai.Model{
+			ID:      strings.TrimPrefix(model.Name, "models/"),
+			Object:  "model",
+			OwnedBy: "google",
+		})
+	}
+	return translate.ReplaceBody(resp, list)
+}
+
+// setHeaders removes the bearer token the openai client sets for api types
+// it does not know when the api key is sent in its own header.
+func setHeaders(r *http.Request) {
+	if r.Header.Get("x-goog-api-key") != "" {
+		r.Header.Del("Authorization")
+	}
+	r.Header.Set("Content-Type", "application/json")
+}
+
+// translateError converts an error response to the form of an openai error so
+// the client reports its message. Errors of a stream are a list of one
+// error.
+func translateError(resp *http.Response) (*http.Response, error) {
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("gemini read error: %w", err)
+	}
+
+	var errResp errorResponse
+	err = json.Unmarshal(data, &errResp)
+	if err != nil {
+		var errResps []errorResponse
+		if json.Unmarshal(data, &errResps) == nil && len(errResps) > 0 {
+			errResp, err = errResps[0], nil
+		}
+	}
+	if err != nil || errResp.Error.Message == "" {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+
+	var oerr openaiError
+	oerr.Error.Message = errResp.Error.Message
+	oerr.Error.Type = errResp.Error.Status
+	return translate.ReplaceBody(resp, oerr)
+}
+
+// translateStream reads the server sent events of a streamed generate content
+// response from r and writes them to w as the server sent events of a chat
+// completion stream.
+func translateStream(r io.Reader, w io.Writer, model string, includeUsage bool) error {
+	sw := translate.StreamWriter{Created: time.Now().Unix(), Model: model, W: w}
+	// calledTools counts the function calls of each candidate so their
+	// indexes continue across chunks
+	calledTools := map[int]int{}
+	// finished records whether each candidate has received a finish reason,
+	// a stream that ends before all of them have was cut short
+	finished := map[int]bool{}
+	var usage *usageMetadata
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(scanner.Bytes()), []byte("data:"))
+		if !ok {
+			continue
+		}
+
+		var resp struct {
+			generateContentResponse
+			errorResponse
+		}
+		err := json.Unmarshal(data, &resp)
+		if err != nil {
+			return fmt.Errorf("unmarshal chunk: %w", err)
+		}
+		if resp.Error.Message != "" {
+			return sw.Error(resp.Error.Message, resp.Error.Status)
+		}
+
+		if sw.ID == "" {
+			sw.ID = completionID(resp.ResponseID)
+		}
+		if resp.ModelVersion != "" {
+			sw.Model = resp.ModelVersion
+		}
+		if resp.UsageMetadata.TotalTokenCount > 0 {
+			usage = &resp.UsageMetadata
+		}
+
+		choices := make([]openai.ChatCompletionStreamChoice, 0, len(resp.Candidates))
+		for _, c := range resp.Candidates {
+			text, reasoning, calls := fromParts(c.Content.Parts, calledTools[c.Index])
+			calledTools[c.Index] += len(calls)
+			finished[c.Index] = finished[c.Index] || c.FinishReason != ""
+			choices = append(choices, openai.ChatCompletionStreamChoice{
+				Delta: openai.ChatCompletionStreamChoiceDelta{
+					Content:          text,
+					ReasoningContent: reasoning,
+					Role:             openai.ChatMessageRoleAssistant,
+					ToolCalls:        calls,
+				},
+				FinishReason: finishReason(c.FinishReason, c.FinishReason != "" && calledTools[c.Index] > 0),
+				Index:        c.Index,
+			})
+		}
+		if len(choices) == 0 {
+			continue
+		}
+
+		err = sw.Write(openai.ChatCompletionStreamResponse{Choices: choices})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	if len(finished) == 0 {
+		return errors.New("stream ended before finishReason")
+	}
+	for index, ok := range finished {
+		if !ok {
+			return fmt.Errorf("stream ended before finishReason of candidate %d", index)
+		}
+	}
+
+	if includeUsage && usage != nil {
+		err := sw.WriteUsage(usage.openai())
+		if err != nil {
+			return err
+		}
+	}
+	return sw.Done()
+}
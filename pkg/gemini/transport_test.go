@@ -0,0 +1,235 @@
+package gemini_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/pastdev/askai/pkg/gemini"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+// newClient returns a client for a stand in for the gemini api that records
+// the request it receives and responds with status and body.
+func newClient(
+	t *testing.T,
+	path string,
+	status int,
+	body string,
+	received *map[string]any,
+) *openai.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, path, r.URL.Path)
+		require.Equal(t, "secret", r.Header.Get("x-goog-api-key"))
+		require.Empty(t, r.Header.Get("Authorization"))
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(received))
+		}
+		if r.URL.Query().Get("alt") == "sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint := config.EndpointConfig{
+		APIType:   gemini.APIType,
+		AuthToken: "secret",
+		BaseURL:   server.URL + "/v1beta",
+	}
+	return endpoint.NewClient()
+}
+
+func TestChat(t *testing.T) {
+	var received map[string]any
+	client := newClient(t, "/v1beta/models/gemini-2.5-flash:generateContent", http.StatusOK, `{
+  "candidates": [{
+    "content": {"role": "model", "parts": [
+      {"text": "checking", "thought": true},
+      {"functionCall": {"name": "weather", "args": {"city": "paris"}}}
+    ]},
+    "finishReason": "STOP",
+    "index": 0
+  }],
+  "usageMetadata": {"promptTokenCount": 20, "candidatesTokenCount": 5, "thoughtsTokenCount": 2, "totalTokenCount": 27},
+  "modelVersion": "gemini-2.5-flash",
+  "responseId": "abc"
+}`, &received)
+
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:     "gemini-2.5-flash",
+			MaxTokens: 100,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+				{Role: openai.ChatMessageRoleUser, Content: "weather in london?"},
+				{
+					Role: openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{{
+						ID:       "call_0",
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: "weather", Arguments: `{"city":"london"}`},
+					}},
+				},
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "call_0", Content: "rain"},
+				{
+					Role: openai.ChatMessageRoleUser,
+					MultiContent: []openai.ChatMessagePart{
+						{Type: openai.ChatMessagePartTypeText, Text: "and paris?"},
+						{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,aGk="}},
+					},
+				},
+			},
+			ReasoningEffort: "low",
+			ToolChoice:      "required",
+			Tools: []openai.Tool{{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        "weather",
+					Description: "current weather",
+					Parameters:  map[string]any{"type": "object"},
+				},
+			}},
+		})
+	require.NoError(t, err)
+
+	expected := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "systemInstruction": {"parts": [{"text": "be brief"}]},
+  "contents": [
+    {"role": "user", "parts": [{"text": "weather in london?"}]},
+    {"role": "model", "parts": [{"functionCall": {"name": "weather", "args": {"city": "london"}}}]},
+    {"role": "user", "parts": [
+      {"functionResponse": {"name": "weather", "response": {"result": "rain"}}},
+      {"text": "and paris?"},
+      {"inlineData": {"mimeType": "image/png", "data": "aGk="}}
+    ]}
+  ],
+  "generationConfig": {
+    "maxOutputTokens": 100,
+    "thinkingConfig": {"includeThoughts": true, "thinkingBudget": 1024}
+  },
+  "tools": [{"functionDeclarations": [
+    {"name": "weather", "description": "current weather", "parametersJsonSchema": {"type": "object"}}
+  ]}],
+  "toolConfig": {"functionCallingConfig": {"mode": "ANY"}}
+}`), &expected))
+	require.Equal(t, expected, received)
+
+	require.Equal(t, "chatcmpl-abc", resp.ID)
+	require.Len(t, resp.Choices, 1)
+	require.Equal(t, openai.FinishReasonToolCalls, resp.Choices[0].FinishReason)
+	require.Equal(t, "checking", resp.Choices[0].Message.ReasoningContent)
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	require.Equal(t, "weather", resp.Choices[0].Message.ToolCalls[0].Function.Name)
+	require.JSONEq(t, `{"city":"paris"}`, resp.Choices[0].Message.ToolCalls[0].Function.Arguments)
+	require.Equal(t, 20, resp.Usage.PromptTokens)
+	require.Equal(t, 7, resp.Usage.CompletionTokens)
+	require.Equal(t, 27, resp.Usage.TotalTokens)
+}
+
+func TestChatError(t *testing.T) {
+	client := newClient(t, "/v1beta/models/nope:generateContent", http.StatusNotFound,
+		`{"error": {"code": 404, "message": "model nope not found", "status": "NOT_FOUND"}}`, &map[string]any{})
+
+	_, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:    "nope",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+		})
+	var apiErr *openai.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "model nope not found", apiErr.Message)
+}
+
+func TestChatStream(t *testing.T) {
+	var received map[string]any
+	client := newClient(t, "/v1beta/models/gemini-2.5-flash:streamGenerateContent", http.StatusOK, `data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "hel"}]}, "index": 0}], "responseId": "abc"}
+
+data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "lo"}]}, "finishReason": "MAX_TOKENS", "index": 0}], "usageMetadata": {"promptTokenCount": 3, "candidatesTokenCount": 4, "totalTokenCount": 7}, "responseId": "abc"}
+
+`, &received)
+
+	stream, err := client.CreateChatCompletionStream(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:         "gemini-2.5-flash",
+			Messages:      []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			Stream:        true,
+			StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		})
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+
+	var content string
+	var finish openai.FinishReason
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, "chatcmpl-abc", chunk.ID)
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+			if choice.FinishReason != "" {
+				finish = choice.FinishReason
+			}
+		}
+	}
+
+	require.Equal(t, "hello", content)
+	require.Equal(t, openai.FinishReasonLength, finish)
+	require.NotNil(t, usage)
+	require.Equal(t, 3, usage.PromptTokens)
+	require.Equal(t, 4, usage.CompletionTokens)
+	require.Equal(t, 7, usage.TotalTokens)
+}
+
+func TestChatStreamEndedEarly(t *testing.T) {
+	client := newClient(t, "/v1beta/models/gemini-2.5-flash:streamGenerateContent", http.StatusOK, `data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "hel"}]}, "index": 0}], "responseId": "abc"}
+
+`, &map[string]any{})
+
+	stream, err := client.CreateChatCompletionStream(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:    "gemini-2.5-flash",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			Stream:   true,
+		})
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+
+	for {
+		_, err = stream.Recv()
+		if err != nil {
+			break
+		}
+	}
+	require.ErrorContains(t, err, "stream ended before finishReason of candidate 0")
+}
+
+func TestModels(t *testing.T) {
+	client := newClient(t, "/v1beta/models", http.StatusOK,
+		`{"models": [{"name": "models/gemini-2.5-flash"}, {"name": "models/gemini-2.5-pro"}]}`, nil)
+
+	models, err := client.ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models.Models, 2)
+	require.Equal(t, "gemini-2.5-flash", models.Models[0].ID)
+	require.Equal(t, "google", models.Models[1].OwnedBy)
+}
@@ -0,0 +1,287 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlH     = 0x08
+	keyCtrlK     = 0x0b
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyBackspace = 0x7f
+	keyEscape    = 0x1b
+)
+
+// ErrInterrupt is returned by ReadLine when Ctrl-C is pressed.
+var ErrInterrupt = errors.New("interrupt")
+
+// Editor reads lines with emacs style editing keys and history. When the
+// input is a terminal it is put in raw mode while reading and the line is
+// echoed to the output, otherwise lines are read as is (the editing keys
+// still work, but nothing is echoed) which allows scripting.
+type Editor struct {
+	// History is the lines previously read, oldest first. Lines are added by
+	// ReadLine.
+	History []string
+
+	echo     bool
+	in       *bufio.Reader
+	inFile   *os.File
+	out      io.Writer
+	buf      []rune
+	cursor   int
+	histPos  int
+	histSave []rune
+	prompt   string
+	// skipLF is set when a line ended with \r so that the \n of a \r\n line
+	// ending is skipped when it is read, rather than waiting for it which
+	// would block on a raw terminal that sends a lone \r for enter.
+	skipLF bool
+}
+
+// AddHistory adds line to the history unless it is blank or the same as the
+// most recent line.
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.History) > 0 && e.History[len(e.History)-1] == line {
+		return
+	}
+	e.History = append(e.History, line)
+}
+
+// ReadLine writes prompt and returns the line entered, which is added to the
+// history. It returns io.EOF if the input ends (or Ctrl-D is pressed) on an
+// empty line and ErrInterrupt if Ctrl-C is pressed.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	e.echo = false
+	if e.inFile != nil {
+		restore, err := makeRaw(e.inFile)
+		if err == nil {
+			e.echo = true
+			defer restore()
+		}
+	}
+
+	e.buf = e.buf[:0]
+	e.cursor = 0
+	e.histPos = len(e.History)
+	e.histSave = nil
+	e.prompt = prompt
+
+	err := e.write(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	line, err := e.edit()
+	if e.echo {
+		// raw mode does not translate newlines
+		_ = e.write("\r\n")
+	}
+	if err != nil {
+		return line, err
+	}
+
+	e.AddHistory(line)
+	return line, nil
+}
+
+func (e *Editor) edit() (string, error) {
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(e.buf) > 0 {
+				return string(e.buf), nil
+			}
+			return "", fmt.Errorf("read line: %w", err)
+		}
+
+		skipLF := e.skipLF
+		e.skipLF = false
+		if r == '\n' && skipLF {
+			continue
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.skipLF = r == '\r'
+			return string(e.buf), nil
+		case keyCtrlC:
+			_ = e.write("^C")
+			return "", ErrInterrupt
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				return "", io.EOF
+			}
+			e.deleteAt(e.cursor)
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.buf)
+		case keyCtrlB:
+			e.cursor = max(0, e.cursor-1)
+		case keyCtrlF:
+			e.cursor = min(len(e.buf), e.cursor+1)
+		case keyBackspace, keyCtrlH:
+			if e.cursor > 0 {
+				e.cursor--
+				e.deleteAt(e.cursor)
+			}
+		case keyCtrlK:
+			e.buf = e.buf[:e.cursor]
+		case keyCtrlU:
+			e.buf = append(e.buf[:0], e.buf[e.cursor:]...)
+			e.cursor = 0
+		case keyCtrlW:
+			start := e.cursor
+			for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.cursor:]...)
+			e.cursor = start
+		case keyCtrlP:
+			e.historyMove(-1)
+		case keyCtrlN:
+			e.historyMove(1)
+		case keyEscape:
+			e.escape()
+		default:
+			if r == utf8.RuneError || unicode.IsControl(r) {
+				continue
+			}
+			e.buf = append(e.buf, 0)
+			copy(e.buf[e.cursor+1:], e.buf[e.cursor:])
+			e.buf[e.cursor] = r
+			e.cursor++
+		}
+
+		err = e.refresh()
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (e *Editor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+// escape handles the escape sequences of the arrow, home, end, and delete
+// keys.
+func (e *Editor) escape() {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+
+	var seq strings.Builder
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return
+		}
+		seq.WriteRune(r)
+		// sequences end with a letter or ~
+		if r == '~' || unicode.IsLetter(r) {
+			break
+		}
+	}
+
+	switch seq.String() {
+	case "A":
+		e.historyMove(-1)
+	case "B":
+		e.historyMove(1)
+	case "C":
+		e.cursor = min(len(e.buf), e.cursor+1)
+	case "D":
+		e.cursor = max(0, e.cursor-1)
+	case "H", "1~", "7~":
+		e.cursor = 0
+	case "F", "4~", "8~":
+		e.cursor = len(e.buf)
+	case "3~":
+		e.deleteAt(e.cursor)
+	}
+}
+
+// historyMove replaces the line with the history entry delta away from the
+// current one, saving the line being edited so it can be returned to.
+func (e *Editor) historyMove(delta int) {
+	pos := e.histPos + delta
+	if pos < 0 || pos > len(e.History) {
+		return
+	}
+
+	if e.histPos == len(e.History) {
+		e.histSave = append([]rune(nil), e.buf...)
+	}
+	e.histPos = pos
+
+	if pos == len(e.History) {
+		e.buf = append(e.buf[:0], e.histSave...)
+	} else {
+		e.buf = append(e.buf[:0], []rune(e.History[pos])...)
+	}
+	e.cursor = len(e.buf)
+}
+
+// refresh redraws the line and positions the cursor.
+func (e *Editor) refresh() error {
+	if !e.echo {
+		return nil
+	}
+
+	var line strings.Builder
+	line.WriteString("\r")
+	line.WriteString(e.prompt)
+	line.WriteString(string(e.buf))
+	line.WriteString("\x1b[K")
+	if back := len(e.buf) - e.cursor; back > 0 {
+		fmt.Fprintf(&line, "\x1b[%dD", back)
+	}
+	return e.write(line.String())
+}
+
+func (e *Editor) write(s string) error {
+	_, err := io.WriteString(e.out, s)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// New returns an Editor reading from in and echoing to out.
+func New(in io.Reader, out io.Writer) *Editor {
+	e := Editor{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+	if f, ok := in.(*os.File); ok {
+		e.inFile = f
+	}
+	return &e
+}
@@ -0,0 +1,102 @@
+package lineedit_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pastdev/askai/pkg/lineedit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLine(t *testing.T) {
+	tester := func(t *testing.T, input string, history []string, expected []string, expectedErr error) {
+		var out strings.Builder
+		editor := lineedit.New(strings.NewReader(input), &out)
+		editor.History = history
+
+		var lines []string
+		for {
+			line, err := editor.ReadLine("> ")
+			if err != nil {
+				require.ErrorIs(t, err, expectedErr)
+				break
+			}
+			lines = append(lines, line)
+		}
+		require.Equal(t, expected, lines)
+	}
+
+	t.Run("lines", func(t *testing.T) {
+		tester(t, "one\r\ntwo\nthree", nil, []string{"one", "two", "three"}, io.EOF)
+	})
+
+	t.Run("editing", func(t *testing.T) {
+		tester(
+			t,
+			""+
+				"helo\x1b[Dl\n"+ // left arrow then insert
+				"abc\x01X\x05Y\n"+ // ctrl-a and ctrl-e
+				"one two\x17three\n"+ // ctrl-w deletes a word
+				"abcd\x02\x02\x0b\n"+ // ctrl-b twice then ctrl-k
+				"abcd\x7f\x7f\n", // backspace
+			nil,
+			[]string{"hello", "XabcY", "one three", "ab", "ab"},
+			io.EOF)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		tester(
+			t,
+			"\x1b[A\x1b[A!\n"+ // up twice recalls the older entry
+				"new\x1b[A\x1b[B\n", // up then down returns to the edited line
+			[]string{"first", "second"},
+			[]string{"first!", "new"},
+			io.EOF)
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+		tester(t, "partial\x03", nil, nil, lineedit.ErrInterrupt)
+	})
+
+	t.Run("ctrl-d", func(t *testing.T) {
+		tester(t, "x\n\x04", nil, []string{"x"}, io.EOF)
+	})
+
+	t.Run("carriage returns", func(t *testing.T) {
+		tester(t, "one\rtwo\r\r\nthree\r", nil, []string{"one", "two", "", "three"}, io.EOF)
+	})
+}
+
+func TestReadLineLoneCarriageReturn(t *testing.T) {
+	// a raw terminal sends a lone \r for enter and nothing more until the
+	// next key, the line must be returned without waiting for it
+	in, w := io.Pipe()
+	t.Cleanup(func() { _ = w.Close() })
+	editor := lineedit.New(in, io.Discard)
+
+	go func() { _, _ = w.Write([]byte("hello\r")) }()
+
+	lines := make(chan string)
+	go func() {
+		line, _ := editor.ReadLine("> ")
+		lines <- line
+	}()
+
+	select {
+	case line := <-lines:
+		require.Equal(t, "hello", line)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "line not returned after lone carriage return")
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	var editor lineedit.Editor
+	editor.AddHistory("a")
+	editor.AddHistory("a")
+	editor.AddHistory("  ")
+	editor.AddHistory("b")
+	require.Equal(t, []string{"a", "b"}, editor.History)
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package lineedit
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is not supported on this platform so lines are read without
+// editing.
+func makeRaw(*os.File) (func(), error) {
+	return nil, errors.New("raw mode not supported")
+}
@@ -0,0 +1,220 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+type chatMessage struct {
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	Role      string     `json:"role"`
+	Thinking  string     `json:"thinking,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+type chatRequest struct {
+	Format    json.RawMessage `json:"format,omitempty"`
+	KeepAlive any             `json:"keep_alive,omitempty"`
+	Messages  []chatMessage   `json:"messages"`
+	Model     string          `json:"model"`
+	Options   map[string]any  `json:"options,omitempty"`
+	Stream    bool            `json:"stream"`
+	Think     *bool           `json:"think,omitempty"`
+	Tools     []openai.Tool   `json:"tools,omitempty"`
+}
+
+type chatResponse struct {
+	Done            bool        `json:"done"`
+	DoneReason      string      `json:"done_reason"`
+	Error           string      `json:"error"`
+	EvalCount       int         `json:"eval_count"`
+	Message         chatMessage `json:"message"`
+	Model           string      `json:"model"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+type toolCall struct {
+	Function toolCallFunction `json:"function"`
+}
+
+type toolCallFunction struct {
+	Arguments json.RawMessage `json:"arguments"`
+	Name      string          `json:"name"`
+}
+
+// toChatRequest converts a chat completion request to a chat request. The
+// options are the endpoint options, sampling settings of the request take
+// precedence over them.
+func toChatRequest(
+	req openai.ChatCompletionRequest,
+	format *translate.ResponseFormat,
+	options map[string]any,
+) (chatRequest, error) {
+	if req.N > 1 {
+		return chatRequest{}, errors.New("n greater than 1 is not supported")
+	}
+
+	creq := chatRequest{
+		Model:  req.Model,
+		Stream: req.Stream,
+		Tools:  req.Tools,
+	}
+	creq.KeepAlive, creq.Options = splitOptions(options)
+
+	setOption := func(name string, value any, set bool) {
+		if set {
+			if creq.Options == nil {
+				creq.Options = map[string]any{}
+			}
+			creq.Options[name] = value
+		}
+	}
+	setOption("temperature", req.Temperature, req.Temperature != 0)
+	setOption("top_p", req.TopP, req.TopP != 0)
+	setOption("frequency_penalty", req.FrequencyPenalty, req.FrequencyPenalty != 0)
+	setOption("presence_penalty", req.PresencePenalty, req.PresencePenalty != 0)
+	setOption("stop", req.Stop, len(req.Stop) > 0)
+	if req.Seed != nil {
+		setOption("seed", *req.Seed, true)
+	}
+	setOption("num_predict", req.MaxTokens, req.MaxTokens != 0)
+	setOption("num_predict", req.MaxCompletionTokens, req.MaxCompletionTokens != 0)
+
+	if req.ReasoningEffort != "" {
+		think := req.ReasoningEffort != "none"
+		creq.Think = &think
+	}
+
+	if format != nil {
+		switch {
+		case format.Type == string(openai.ChatCompletionResponseFormatTypeJSONObject):
+			creq.Format = json.RawMessage(`"json"`)
+		case format.JSONSchema != nil && len(format.JSONSchema.Schema) > 0:
+			creq.Format = format.JSONSchema.Schema
+		}
+	}
+
+	// tool results are identified by name rather than id
+	toolNames := map[string]string{}
+	for _, msg := range req.Messages {
+		cmsg := chatMessage{
+			Content: translate.MessageText(msg),
+			Role:    msg.Role,
+		}
+		if msg.Role == openai.ChatMessageRoleDeveloper {
+			cmsg.Role = openai.ChatMessageRoleSystem
+		}
+
+		for _, part := range msg.MultiContent {
+			if part.Type != openai.ChatMessagePartTypeImageURL || part.ImageURL == nil {
+				continue
+			}
+			_, data, ok := strings.Cut(part.ImageURL.URL, ";base64,")
+			if !ok || !strings.HasPrefix(part.ImageURL.URL, "data:") {
+				return creq, errors.New("only data url images are supported")
+			}
+			cmsg.Images = append(cmsg.Images, data)
+		}
+
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+			arguments := json.RawMessage(call.Function.Arguments)
+			if strings.TrimSpace(call.Function.Arguments) == "" {
+				arguments = json.RawMessage("{}")
+			}
+			cmsg.ToolCalls = append(cmsg.ToolCalls, toolCall{
+				Function: toolCallFunction{Arguments: arguments, Name: call.Function.Name},
+			})
+		}
+
+		if msg.Role == openai.ChatMessageRoleTool {
+			cmsg.ToolName = toolNames[msg.ToolCallID]
+		}
+
+		creq.Messages = append(creq.Messages, cmsg)
+	}
+	return creq, nil
+}
+
+// splitOptions returns keep_alive, which is not a model option, and the rest
+// of the options.
+func splitOptions(options map[string]any) (any, map[string]any) {
+	if len(options) == 0 {
+		return nil, nil
+	}
+
+	options = maps.Clone(options)
+	keepAlive := options["keep_alive"]
+	delete(options, "keep_alive")
+	return keepAlive, options
+}
+
+// fromChatResponse converts a chat response to a chat completion response.
+func fromChatResponse(resp chatResponse) openai.ChatCompletionResponse {
+	msg := openai.ChatCompletionMessage{
+		Content:          resp.Message.Content,
+		ReasoningContent: resp.Message.Thinking,
+		Role:             openai.ChatMessageRoleAssistant,
+		ToolCalls:        toolCalls(resp.Message.ToolCalls, 0),
+	}
+
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			FinishReason: finishReason(resp.DoneReason, len(msg.ToolCalls) > 0),
+			Message:      msg,
+		}},
+		Created: time.Now().Unix(),
+		ID:      completionID(),
+		Model:   resp.Model,
+		Object:  "chat.completion",
+		Usage:   usage(resp.PromptEvalCount, resp.EvalCount),
+	}
+}
+
+func completionID() string {
+	return fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+}
+
+func finishReason(doneReason string, calledTools bool) openai.FinishReason {
+	switch {
+	case calledTools:
+		return openai.FinishReasonToolCalls
+	case doneReason == "length":
+		return openai.FinishReasonLength
+	}
+	return openai.FinishReasonStop
+}
+
+func toolCalls(calls []toolCall, start int) []openai.ToolCall {
+	var result []openai.ToolCall
+	for i, call := range calls {
+		index := start + i
+		result = append(result, openai.ToolCall{
+			Function: openai.FunctionCall{
+				Arguments: string(call.Function.Arguments),
+				Name:      call.Function.Name,
+			},
+			ID:    fmt.Sprintf("call_%d", index),
+			Index: &index,
+			Type:  openai.ToolTypeFunction,
+		})
+	}
+	return result
+}
+
+func usage(prompt int, completion int) openai.Usage {
+	return openai.Usage{
+		CompletionTokens: completion,
+		PromptTokens:     prompt,
+		TotalTokens:      prompt + completion,
+	}
+}
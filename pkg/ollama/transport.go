@@ -0,0 +1,301 @@
+// Package ollama lets an openai client use the native ollama api, which
+// unlike its openai compatible api supports model options such as num_ctx,
+// by translating requests and responses in its transport.
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pastdev/askai/pkg/translate"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	APIType        openai.APIType = "OLLAMA"
+	DefaultBaseURL                = "http://localhost:11434"
+
+	// maxLineSize is the largest line of a streamed response that can be
+	// read.
+	maxLineSize = 16 << 20
+)
+
+// Transport translates the chat completion, embedding and model list
+// requests of an openai client to the native ollama api and the responses
+// back.
+type Transport struct {
+	// Options are model options, such as num_ctx, sent with every request.
+	// keep_alive is also accepted and sent as the keep alive of the request.
+	Options map[string]any
+	Wrapped http.RoundTripper
+}
+
+type embedRequest struct {
+	Dimensions int            `json:"dimensions,omitempty"`
+	Input      any            `json:"input"`
+	KeepAlive  any            `json:"keep_alive,omitempty"`
+	Model      string         `json:"model"`
+	Options    map[string]any `json:"options,omitempty"`
+}
+
+type embedResponse struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	Model           string      `json:"model"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type openaiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+type tagsResponse struct {
+	Models []struct {
+		ModifiedAt time.Time `json:"modified_at"`
+		Name       string    `json:"name"`
+	} `json:"models"`
+}
+
+// NewTransport returns a transport that sends translated requests using
+// wrapped.
+func NewTransport(wrapped http.RoundTripper, options map[string]any) *Transport {
+	return &Transport{Options: options, Wrapped: wrapped}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		return t.chat(r)
+	case strings.HasSuffix(r.URL.Path, "/embeddings"):
+		return t.embed(r)
+	case strings.HasSuffix(r.URL.Path, "/models") && r.Method == http.MethodGet:
+		return t.tags(r)
+	}
+	return nil, fmt.Errorf("ollama: %s is not supported", r.URL.Path)
+}
+
+func (t *Transport) chat(r *http.Request) (*http.Response, error) {
+	req, format, err := translate.DecodeChatRequest(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+
+	creq, err := toChatRequest(req, format, t.Options)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+
+	resp, err := t.send(r, "/chat/completions", "/api/chat", creq)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	if creq.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		return translate.Stream(resp, func(r io.Reader, w io.Writer) error {
+			return translateStream(r, w, includeUsage)
+		}), nil
+	}
+
+	var cresp chatResponse
+	err = json.NewDecoder(resp.Body).Decode(&cresp)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ollama decode response: %w", err)
+	}
+	return translate.ReplaceBody(resp, fromChatResponse(cresp))
+}
+
+func (t *Transport) embed(r *http.Request) (*http.Response, error) {
+	var req openai.EmbeddingRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ollama decode request: %w", err)
+	}
+
+	ereq := embedRequest{
+		Dimensions: req.Dimensions,
+		Input:      req.Input,
+		Model:      string(req.Model),
+	}
+	ereq.KeepAlive, ereq.Options = splitOptions(t.Options)
+
+	resp, err := t.send(r, "/embeddings", "/api/embed", ereq)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	var eresp embedResponse
+	err = json.NewDecoder(resp.Body).Decode(&eresp)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ollama decode response: %w", err)
+	}
+
+	result := openai.EmbeddingResponse{
+		Data:   make([]openai.Embedding, 0, len(eresp.Embeddings)),
+		Model:  openai.EmbeddingModel(eresp.Model),
+		Object: "list",
+		Usage:  usage(eresp.PromptEvalCount, 0),
+	}
+	for i, embedding := range eresp.Embeddings {
+		result.Data = append(result.Data, openai.Embedding{
+			Embedding: embedding,
+			Index:     i,
+			Object:    "embedding",
+		})
+	}
+	return translate.ReplaceBody(resp, result)
+}
+
+func (t *Transport) tags(r *http.Request) (*http.Response, error) {
+	resp, err := t.send(r, "/models", "/api/tags", nil)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	var tags tagsResponse
+	err = json.NewDecoder(resp.Body).Decode(&tags)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ollama decode models: %w", err)
+	}
+
+	list := openai.ModelsList{Models: make([]openai.Model, 0, len(tags.Models))}
+	for _, model := range tags.Models {
+		list.Models = append(list.Models, openai.Model{
+			CreatedAt: model.ModifiedAt.Unix(),
+			ID:        model.Name,
+			Object:    "model",
+			OwnedBy:   "ollama",
+		})
+	}
+	return translate.ReplaceBody(resp, list)
+}
+
+// send sends body, or nothing if it is nil, to the native api path that
+// replaces the openai path of r. Error responses are translated.
+func (t *Transport) send(r *http.Request, openaiPath string, path string, body any) (*http.Response, error) {
+	out := r.Clone(r.Context())
+	// the openai compatible api is under /v1 which is often left on the base
+	// url when switching to the native api
+	prefix := strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, openaiPath), "/v1")
+	out.URL.Path = prefix + path
+
+	if body != nil {
+		err := translate.SetBody(out, body)
+		if err != nil {
+			return nil, fmt.Errorf("ollama: %w", err)
+		}
+	}
+
+	resp, err := t.Wrapped.RoundTrip(out)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return translateError(resp)
+	}
+	return resp, nil
+}
+
+// translateError converts an error response to the form of an openai error so
+// the client reports its message.
+func translateError(resp *http.Response) (*http.Response, error) {
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ollama read error: %w", err)
+	}
+
+	var errResp errorResponse
+	err = json.Unmarshal(data, &errResp)
+	if err != nil || errResp.Error == "" {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+
+	var oerr openaiError
+	oerr.Error.Message = errResp.Error
+	oerr.Error.Type = "ollama_error"
+	return translate.ReplaceBody(resp, oerr)
+}
+
+// translateStream reads the newline delimited json of a streamed chat response
+// from r and writes it to w as the server sent events of a chat completion
+// stream.
+func translateStream(r io.Reader, w io.Writer, includeUsage bool) error {
+	sw := translate.StreamWriter{Created: time.Now().Unix(), ID: completionID(), W: w}
+	calledTools := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var resp chatResponse
+		err := json.Unmarshal(line, &resp)
+		if err != nil {
+			return fmt.Errorf("unmarshal chunk: %w", err)
+		}
+
+		if resp.Error != "" {
+			return sw.Error(resp.Error, "ollama_error")
+		}
+		sw.Model = resp.Model
+
+		choice := openai.ChatCompletionStreamChoice{
+			Delta: openai.ChatCompletionStreamChoiceDelta{
+				Content:          resp.Message.Content,
+				ReasoningContent: resp.Message.Thinking,
+				Role:             resp.Message.Role,
+				ToolCalls:        toolCalls(resp.Message.ToolCalls, calledTools),
+			},
+		}
+		calledTools += len(resp.Message.ToolCalls)
+		if resp.Done {
+			choice.FinishReason = finishReason(resp.DoneReason, calledTools > 0)
+		}
+
+		err = sw.Write(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{choice},
+		})
+		if err != nil {
+			return err
+		}
+
+		if resp.Done {
+			if includeUsage {
+				err := sw.WriteUsage(usage(resp.PromptEvalCount, resp.EvalCount))
+				if err != nil {
+					return err
+				}
+			}
+			return sw.Done()
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return errors.New("stream ended before done")
+}
@@ -0,0 +1,187 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/askai/pkg/config"
+	"github.com/pastdev/askai/pkg/ollama"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+// newClient returns a client for a stand in for the ollama api that records
+// the request it receives and responds with body.
+func newClient(t *testing.T, path string, body string, received *map[string]any) *openai.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, path, r.URL.Path)
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(received))
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint := config.EndpointConfig{
+		APIType: ollama.APIType,
+		// the /v1 of the openai compatible api is dropped
+		BaseURL: server.URL + "/v1",
+		OllamaOptions: map[string]any{
+			"keep_alive":  "10m",
+			"num_ctx":     8192,
+			"temperature": 0.2,
+		},
+	}
+	return endpoint.NewClient()
+}
+
+func TestChat(t *testing.T) {
+	var received map[string]any
+	client := newClient(t, "/api/chat", `{
+  "model": "llama3",
+  "message": {"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "weather", "arguments": {"city": "paris"}}}]},
+  "done": true,
+  "done_reason": "stop",
+  "prompt_eval_count": 20,
+  "eval_count": 5
+}`, &received)
+
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:       "llama3",
+			MaxTokens:   100,
+			Temperature: 0.7,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+				{Role: openai.ChatMessageRoleUser, Content: "weather in london?"},
+				{
+					Role: openai.ChatMessageRoleAssistant,
+					ToolCalls: []openai.ToolCall{{
+						ID:       "call_0",
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: "weather", Arguments: `{"city":"london"}`},
+					}},
+				},
+				{Role: openai.ChatMessageRoleTool, ToolCallID: "call_0", Content: "rain"},
+				{
+					Role: openai.ChatMessageRoleUser,
+					MultiContent: []openai.ChatMessagePart{
+						{Type: openai.ChatMessagePartTypeText, Text: "and paris?"},
+						{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,aGk="}},
+					},
+				},
+			},
+			ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+		})
+	require.NoError(t, err)
+
+	expected := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "model": "llama3",
+  "stream": false,
+  "format": "json",
+  "keep_alive": "10m",
+  "options": {"num_ctx": 8192, "temperature": 0.7, "num_predict": 100},
+  "messages": [
+    {"role": "system", "content": "be brief"},
+    {"role": "user", "content": "weather in london?"},
+    {"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "weather", "arguments": {"city": "london"}}}]},
+    {"role": "tool", "content": "rain", "tool_name": "weather"},
+    {"role": "user", "content": "and paris?", "images": ["aGk="]}
+  ]
+}`), &expected))
+	// float32 temperature does not round trip exactly
+	options, ok := received["options"].(map[string]any)
+	require.True(t, ok)
+	require.InDelta(t, 0.7, options["temperature"], 0.0001)
+	options["temperature"] = 0.7
+	require.Equal(t, expected, received)
+
+	require.Len(t, resp.Choices, 1)
+	require.Equal(t, openai.FinishReasonToolCalls, resp.Choices[0].FinishReason)
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	require.Equal(t, "weather", resp.Choices[0].Message.ToolCalls[0].Function.Name)
+	require.JSONEq(t, `{"city":"paris"}`, resp.Choices[0].Message.ToolCalls[0].Function.Arguments)
+	require.Equal(t, openai.Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25}, resp.Usage)
+}
+
+func TestChatStream(t *testing.T) {
+	var received map[string]any
+	client := newClient(t, "/api/chat", `{"model":"llama3","message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":"hello"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":" world"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":3,"eval_count":4}
+`, &received)
+
+	stream, err := client.CreateChatCompletionStream(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:         "llama3",
+			Messages:      []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+			Stream:        true,
+			StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+		})
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+	require.Equal(t, true, received["stream"])
+
+	var content string
+	var reasoning string
+	var finish openai.FinishReason
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+			reasoning += choice.Delta.ReasoningContent
+			if choice.FinishReason != "" {
+				finish = choice.FinishReason
+			}
+		}
+	}
+
+	require.Equal(t, "hello world", content)
+	require.Equal(t, "hmm", reasoning)
+	require.Equal(t, openai.FinishReasonLength, finish)
+	require.Equal(t, &openai.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7}, usage)
+}
+
+func TestEmbed(t *testing.T) {
+	var received map[string]any
+	client := newClient(t, "/api/embed", `{"model":"nomic","embeddings":[[0.1,0.2],[0.3,0.4]],"prompt_eval_count":6}`, &received)
+
+	resp, err := client.CreateEmbeddings(
+		context.Background(),
+		openai.EmbeddingRequest{Input: []string{"a", "b"}, Model: "nomic"})
+	require.NoError(t, err)
+	require.Equal(t, "nomic", received["model"])
+	require.Equal(t, []any{"a", "b"}, received["input"])
+	require.Equal(t, "10m", received["keep_alive"])
+	require.Len(t, resp.Data, 2)
+	require.Equal(t, []float32{0.3, 0.4}, resp.Data[1].Embedding)
+	require.Equal(t, 1, resp.Data[1].Index)
+	require.Equal(t, 6, resp.Usage.PromptTokens)
+}
+
+func TestTags(t *testing.T) {
+	client := newClient(t, "/api/tags", `{"models":[{"name":"llama3:latest","modified_at":"2025-01-02T03:04:05Z"}]}`, nil)
+
+	models, err := client.ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models.Models, 1)
+	require.Equal(t, "llama3:latest", models.Models[0].ID)
+	require.Equal(t, "ollama", models.Models[0].OwnedBy)
+}
@@ -0,0 +1,41 @@
+package tokenizer
+
+import "strings"
+
+// approximateBytesPerToken is the average number of bytes per token of
+// English text and code for most BPE encodings.
+const approximateBytesPerToken = 4
+
+var _ Tokenizer = ApproximateTokenizer{}
+
+// ApproximateTokenizer is a Tokenizer for models without a known encoding
+// that treats every 4 bytes as a token. The counts are close enough to
+// estimate usage, and the tokens still decode back to the original text so
+// they can be used for truncation. The tokens mean nothing to any model.
+type ApproximateTokenizer struct{}
+
+func (ApproximateTokenizer) Decode(tokens []int) string {
+	var text strings.Builder
+	for _, token := range tokens {
+		n := token >> (8 * approximateBytesPerToken)
+		for i := range n {
+			text.WriteByte(byte(token >> (8 * i)))
+		}
+	}
+	// truncation may split a multi-byte rune
+	return strings.ToValidUTF8(text.String(), "")
+}
+
+// Encode returns the tokens of text, special tokens are not supported.
+func (ApproximateTokenizer) Encode(text string, _ []string, _ []string) []int {
+	tokens := make([]int, 0, (len(text)+approximateBytesPerToken-1)/approximateBytesPerToken)
+	for i := 0; i < len(text); i += approximateBytesPerToken {
+		chunk := text[i:min(i+approximateBytesPerToken, len(text))]
+		token := len(chunk) << (8 * approximateBytesPerToken)
+		for j := range len(chunk) {
+			token |= int(chunk[j]) << (8 * j)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
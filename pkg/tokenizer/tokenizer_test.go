@@ -52,3 +52,16 @@ func TestTokenize(t *testing.T) {
 			"")
 	})
 }
+
+func TestApproximateTokenizer(t *testing.T) {
+	var tkzr tokenizer.ApproximateTokenizer
+
+	tokens := tkzr.Encode("Hello world!", nil, nil)
+	require.Len(t, tokens, 3)
+	require.Equal(t, "Hello world!", tkzr.Decode(tokens))
+	require.Equal(t, "Hello wo", tkzr.Decode(tokens[:2]))
+
+	// a truncated rune is dropped rather than decoded as garbage
+	tokens = tkzr.Encode("abc€", nil, nil)
+	require.Equal(t, "abc", tkzr.Decode(tokens[:1]))
+}
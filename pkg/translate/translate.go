@@ -0,0 +1,181 @@
+// Package translate has the helpers shared by the transports that let an
+// openai client talk to other apis by translating requests and responses.
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ResponseFormat is the part of an openai.ChatCompletionResponseFormat that
+// translations need, the schema of the openai type is an interface that
+// cannot be unmarshaled.
+type ResponseFormat struct {
+	JSONSchema *struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"json_schema"`
+	Type string `json:"type"`
+}
+
+// DecodeChatRequest unmarshals a chat completion request along with its
+// response format, if any.
+func DecodeChatRequest(r io.Reader) (openai.ChatCompletionRequest, *ResponseFormat, error) {
+	var fields map[string]json.RawMessage
+	err := json.NewDecoder(r).Decode(&fields)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, nil, fmt.Errorf("decode request: %w", err)
+	}
+
+	var format *ResponseFormat
+	if raw, ok := fields["response_format"]; ok {
+		err := json.Unmarshal(raw, &format)
+		if err != nil {
+			return openai.ChatCompletionRequest{}, nil, fmt.Errorf("decode response format: %w", err)
+		}
+		delete(fields, "response_format")
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, nil, fmt.Errorf("decode request: %w", err)
+	}
+
+	var req openai.ChatCompletionRequest
+	err = json.Unmarshal(data, &req)
+	if err != nil {
+		return req, nil, fmt.Errorf("decode request: %w", err)
+	}
+	return req, format, nil
+}
+
+// MessageText returns the text of msg, ignoring any parts that are not text.
+func MessageText(msg openai.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+
+	var texts []string
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// ReplaceBody replaces the body of resp with v encoded as json.
+func ReplaceBody(resp *http.Response, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode response: %w", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	resp.Header.Set("Content-Type", "application/json")
+	return resp, nil
+}
+
+// SetBody sets the body of r to v encoded as json so that it can be replayed
+// by retries.
+func SetBody(r *http.Request, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
+// Stream replaces the body of resp with the server sent events of a chat
+// completion stream written by translate as it reads the original body.
+func Stream(resp *http.Response, translate func(r io.Reader, w io.Writer) error) *http.Response {
+	pr, pw := io.Pipe()
+	upstream := resp.Body
+	go func() {
+		err := translate(upstream, pw)
+		_ = upstream.Close()
+		_ = pw.CloseWithError(err)
+	}()
+
+	resp.Body = pr
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Type", "text/event-stream")
+	return resp
+}
+
+// StreamWriter writes the server sent events of a chat completion stream.
+type StreamWriter struct {
+	Created int64
+	ID      string
+	Model   string
+	W       io.Writer
+}
+
+// Done writes the event that ends the stream.
+func (s *StreamWriter) Done() error {
+	_, err := io.WriteString(s.W, "data: [DONE]\n\n")
+	if err != nil {
+		return fmt.Errorf("write done: %w", err)
+	}
+	return nil
+}
+
+// Error writes an error event which ends the stream with message.
+func (s *StreamWriter) Error(message string, errType string) error {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	resp.Error.Message = message
+	resp.Error.Type = errType
+	return s.event(resp)
+}
+
+// Write writes chunk, filling in the fields common to all chunks.
+func (s *StreamWriter) Write(chunk openai.ChatCompletionStreamResponse) error {
+	chunk.Created = s.Created
+	chunk.ID = s.ID
+	if chunk.Model == "" {
+		chunk.Model = s.Model
+	}
+	chunk.Object = "chat.completion.chunk"
+	return s.event(chunk)
+}
+
+// WriteUsage writes the chunk with no choices that reports usage.
+func (s *StreamWriter) WriteUsage(usage openai.Usage) error {
+	return s.Write(openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{},
+		Usage:   &usage,
+	})
+}
+
+func (s *StreamWriter) event(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	_, err = fmt.Fprintf(s.W, "data: %s\n\n", data)
+	if err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	return nil
+}